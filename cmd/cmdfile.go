@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// The refocus command read from stdin with -cmd-file -, kept as stdin can only
+// be read once but the options are validated again on reload.
+var (
+	stdinOnce    sync.Once
+	stdinCommand []byte
+	stdinErr     error
+)
+
+// readCommandFile reads the -cmd-file at path, or stdin if path is "-". It
+// is an error for the file to hold no command.
+func readCommandFile(path string) (string, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if path == "-" {
+		stdinOnce.Do(func() {
+			stdinCommand, stdinErr = io.ReadAll(os.Stdin)
+		})
+		b, err = stdinCommand, stdinErr
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading command file: %w", err)
+	}
+	if len(commandLines(string(b))) == 0 {
+		return "", fmt.Errorf("command file %s holds no command", path)
+	}
+	return string(b), nil
+}
+
+// commandLines returns the lines of a -cmd-file with surrounding whitespace
+// trimmed, skipping blank lines and # comments. Without -shell each line is an
+// argument of the refocus command.
+func commandLines(contents string) []string {
+	var lines []string
+	for _, line := range strings.Split(contents, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config file keys that aren't flag names. commandKey holds the refocus
+// command and its arguments, rulesKey a list of rules each describing a
+// separate watcher and nameKey the name of a rule.
+const (
+	commandKey = "command"
+	rulesKey   = "rules"
+	nameKey    = "name"
+)
+
+// envPrefix prefixes the environment variable for each flag, see envName.
+const envPrefix = "STAY_FOCUSED_"
+
+// notConfigurable lists flags that make no sense in a config file.
+var notConfigurable = map[string]bool{
+	"config":      true,
+	"config-test": true,
+	"version":     true,
+}
+
+// envName returns the environment variable setting the named flag, ex:
+// STAY_FOCUSED_CMD_TIMEOUT for -cmd-timeout.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets every flag in fs that wasn't passed on the command line from
+// its environment variable, if present.
+func applyEnv(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] || f.Name == "version" {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("%s: %w", envName(f.Name), setErr)
+			}
+		}
+	})
+	return err
+}
+
+// cmdlineFlags records the flags set on the command line or from the
+// environment, before the config file was applied. Reloading the config file
+// starts again from these.
+var cmdlineFlags = map[string]bool{}
+
+// loadConfig reads the YAML config file at path and applies its values to any
+// flag in fs that wasn't passed on the command line or set from the
+// environment, so precedence is command line flags, then environment
+// variables, then the config file, then built-in defaults. Keys are flag
+// names, plus "command" for the refocus command, ex:
+//
+//	proc: [zoom, teams]
+//	check: 30s
+//	refocus: 10s
+//	command: [v4l2-ctl, -d, /dev/video0, --set-ctrl, focus_automatic_continuous=1]
+//
+// It returns the refocus command from the file, if any, and the options for
+// each entry under "rules". When reloading fs holds only the watcher flags,
+// other settings can't be changed while running and a warning is logged if
+// they were.
+func loadConfig(path string, fs *flag.FlagSet) ([]string, []*options, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var values map[string]any
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&values); err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	var unknown []string
+	for key := range values {
+		if key != commandKey && key != rulesKey && (flag.Lookup(key) == nil || notConfigurable[key]) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, nil, fmt.Errorf("unknown keys in config file %s: %s", path, strings.Join(unknown, ", "))
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var (
+		command []string
+		rules   []any
+	)
+	for key, value := range values {
+		switch {
+		case key == commandKey:
+			if command, err = configList(value); err != nil {
+				return nil, nil, fmt.Errorf("config file %s: %s: %w", path, key, err)
+			}
+			continue
+		case key == rulesKey:
+			var ok bool
+			if rules, ok = value.([]any); !ok {
+				return nil, nil, fmt.Errorf("config file %s: %s: expected a list of rules", path, key)
+			}
+			continue
+		case set[key]:
+			continue
+		case fs.Lookup(key) == nil:
+			if list, _ := configList(value); !cmdlineFlags[key] && strings.Join(list, ",") != flag.Lookup(key).Value.String() {
+				slog.Warn("Setting can't be changed without restarting, skipped", "setting", key)
+			}
+			continue
+		}
+
+		if err := setFlag(fs, key, value); err != nil {
+			return nil, nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	ruleOpts := make([]*options, len(rules))
+	for i, rule := range rules {
+		values, ok := rule.(map[string]any)
+		if !ok {
+			return nil, nil, fmt.Errorf("config file %s: rule %d: expected a map of settings", path, i+1)
+		}
+		o, err := ruleOptions(values, fs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("config file %s: rule %d: %w", path, i+1, err)
+		}
+		if o.name == "" {
+			o.name = "rule " + strconv.Itoa(i+1)
+		}
+		ruleOpts[i] = o
+	}
+
+	return command, ruleOpts, nil
+}
+
+// ruleOptions builds the options for a rule. Settings missing from the rule
+// are inherited from the flags set in parent, from the command line,
+// environment or top level of the config file.
+func ruleOptions(values map[string]any, parent *flag.FlagSet) (*options, error) {
+	o := &options{}
+	fs := flag.NewFlagSet("rule", flag.ContinueOnError)
+	o.register(fs)
+
+	var unknown []string
+	for key := range values {
+		if key != commandKey && key != nameKey && fs.Lookup(key) == nil {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown keys: %s", strings.Join(unknown, ", "))
+	}
+
+	for key, value := range values {
+		var err error
+		switch key {
+		case commandKey:
+			o.command, err = configList(value)
+		case nameKey:
+			o.name = fmt.Sprint(value)
+		default:
+			err = setFlag(fs, key, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	var err error
+	parent.Visit(func(f *flag.Flag) {
+		if _, ok := values[f.Name]; ok || err != nil || fs.Lookup(f.Name) == nil {
+			return
+		}
+		err = fs.Set(f.Name, f.Value.String())
+	})
+	return o, err
+}
+
+// configOptions applies the config file to base, the options registered on
+// fs, and returns the options for each watcher to run: one for each rule, or
+// base itself if there are none. Rules without a command use base's.
+func configOptions(fs *flag.FlagSet, base *options) ([]*options, error) {
+	configCommand, rules, err := loadConfig(configFile, fs)
+	if err != nil {
+		return nil, err
+	}
+	if len(base.command) == 0 {
+		base.command = configCommand
+	}
+	if len(rules) == 0 {
+		return []*options{base}, nil
+	}
+	for _, rule := range rules {
+		if len(rule.command) == 0 {
+			rule.command = base.command
+		}
+	}
+	return rules, nil
+}
+
+// reloadOptions reads the config file again, starting over from the flags
+// set on the command line and environment, and returns the options for each
+// watcher to run.
+func reloadOptions() ([]*options, error) {
+	base := &options{command: flag.Args()}
+	fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+	base.register(fs)
+
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		if err != nil || !cmdlineFlags[f.Name] || fs.Lookup(f.Name) == nil {
+			return
+		}
+		err = fs.Set(f.Name, f.Value.String())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	watchOpts, err := configOptions(fs, base)
+	if err != nil {
+		return nil, err
+	}
+	return expandDevices(watchOpts)
+}
+
+// setFlag sets the named flag in fs from a config file value. Lists are
+// joined with commas.
+func setFlag(fs *flag.FlagSet, name string, value any) error {
+	list, err := configList(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := fs.Set(name, strings.Join(list, ",")); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// configList converts a scalar or list config value to a list of strings.
+func configList(value any) ([]string, error) {
+	switch v := value.(type) {
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case []any, map[string]any:
+				return nil, errors.New("lists may only contain plain values")
+			}
+			list = append(list, fmt.Sprint(item))
+		}
+		return list, nil
+	case map[string]any:
+		return nil, errors.New("expected a value or list")
+	case nil:
+		return nil, nil
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
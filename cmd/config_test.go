@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/go-ps"
+
+	"stay-focused/focus"
+)
+
+// loadTestOptions builds the watcher options the way main does, from the
+// command line args, the environment and the config file holding config.
+func loadTestOptions(t *testing.T, args []string, config string) ([]*options, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	base := &options{}
+	base.register(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyEnv(fs); err != nil {
+		return nil, err
+	}
+	base.command = fs.Args()
+
+	path := filepath.Join(t.TempDir(), "stay-focused.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	previous := configFile
+	configFile = path
+	t.Cleanup(func() { configFile = previous })
+	return configOptions(fs, base)
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		env    map[string]string
+		config string
+		want   string
+	}{
+		{
+			name: "default",
+			want: "1m0s",
+		},
+		{
+			name:   "config file over default",
+			config: "check: 30s\n",
+			want:   "30s",
+		},
+		{
+			name:   "environment over config file",
+			env:    map[string]string{"STAY_FOCUSED_CHECK": "45s"},
+			config: "check: 30s\n",
+			want:   "45s",
+		},
+		{
+			name:   "command line over environment",
+			args:   []string{"-check", "2m"},
+			env:    map[string]string{"STAY_FOCUSED_CHECK": "45s"},
+			config: "check: 30s\n",
+			want:   "2m0s",
+		},
+		{
+			name:   "command line over config file",
+			args:   []string{"-check", "3"},
+			config: "check: 30s\n",
+			want:   "3m0s",
+		},
+		{
+			name:   "environment over default",
+			env:    map[string]string{"STAY_FOCUSED_CHECK": "90s"},
+			config: "refocus: 5s\n",
+			want:   "1m30s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			watchOpts, err := loadTestOptions(t, tt.args, tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := watchOpts[0].checkInterval.String(); got != tt.want {
+				t.Errorf("check = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigRules(t *testing.T) {
+	const config = `
+check: 30s
+command: [v4l2-ctl, --all]
+rules:
+  - name: zoom
+    proc: zoom
+    check: 2m
+  - proc: teams
+    command: [teams-refocus]
+`
+	watchOpts, err := loadTestOptions(t, []string{"-refocus", "15s"}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(watchOpts) != 2 {
+		t.Fatalf("got %d rules, want 2", len(watchOpts))
+	}
+
+	tests := []struct {
+		name, check, refocus, proc, command string
+	}{
+		{"zoom", "2m0s", "15s", "zoom", "v4l2-ctl --all"},
+		{"rule 2", "30s", "15s", "teams", "teams-refocus"},
+	}
+	for i, tt := range tests {
+		o := watchOpts[i]
+		got := []string{o.name, o.checkInterval.String(), o.refocusEvery.String(), o.processNames.String(), strings.Join(o.command, " ")}
+		want := []string{tt.name, tt.check, tt.refocus, tt.proc, tt.command}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("rule %d = %q, want %q", i+1, got, want)
+		}
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		name, config, want string
+	}{
+		{"unknown key", "chek: 30s\nprocs: zoom\n", "unknown keys in config file"},
+		{"unknown key lists all", "chek: 30s\nprocs: zoom\n", "chek, procs"},
+		{"not configurable", "version: true\n", "unknown keys"},
+		{"bad value", "check: soon\n", "check"},
+		{"nested list", "proc: [[zoom]]\n", "lists may only contain plain values"},
+		{"rules not a list", "rules: zoom\n", "expected a list of rules"},
+		{"unknown rule key", "rules:\n  - prok: zoom\n", "rule 1: unknown keys: prok"},
+		{"bad yaml", "check: [30s\n", "parsing config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadTestOptions(t, nil, tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// fakeProcess is a process running as this test, listed by fakeLister.
+type fakeProcess string
+
+func (p fakeProcess) Pid() int           { return os.Getpid() }
+func (p fakeProcess) PPid() int          { return 1 }
+func (p fakeProcess) Executable() string { return string(p) }
+
+// fakeLister is a focus.ProcessLister listing the executables last set.
+type fakeLister struct {
+	mu    sync.Mutex
+	procs []ps.Process
+}
+
+func (l *fakeLister) Processes() ([]ps.Process, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.procs, nil
+}
+
+func (l *fakeLister) set(executables ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.procs = nil
+	for _, executable := range executables {
+		l.procs = append(l.procs, fakeProcess(executable))
+	}
+}
+
+// countingRunner is a focus.CommandRunner counting the commands run, by
+// their last argument, without running them.
+type countingRunner struct {
+	mu   sync.Mutex
+	runs map[string]int
+}
+
+func (r *countingRunner) Run(ctx context.Context, argv []string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs[argv[len(argv)-1]]++
+	return nil, nil
+}
+
+func (r *countingRunner) count(name string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.runs[name]
+}
+
+func TestConfigRulesIndependent(t *testing.T) {
+	const config = `
+check: 1h
+refocus: 5ms
+rules:
+  - proc: zoom
+    command: [true, zoom]
+  - proc: teams
+    command: [true, teams]
+`
+	watchOpts, err := loadTestOptions(t, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lister := &fakeLister{}
+	runner := &countingRunner{runs: map[string]int{}}
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	wrapRunner = func(focus.CommandRunner) focus.CommandRunner { return runner }
+	defer func() {
+		slog.SetDefault(logger)
+		wrapRunner = nil
+	}()
+	watchers := make([]*focus.Watcher, len(watchOpts))
+	for i, o := range watchOpts {
+		if watchers[i], err = o.watcher(false); err != nil {
+			t.Fatal(err)
+		}
+		watchers[i].Lister = lister
+	}
+
+	lister.set("zoom")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runWatchers(ctx, watchers) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("runWatchers() = %v", err)
+		}
+	}()
+
+	waitForRuns := func(name string, n int) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for runner.count(name) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for the %s rule to refocus", name)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitForRuns("zoom", 3)
+	if n := runner.count("teams"); n != 0 {
+		t.Errorf("teams rule refocused %d times with only zoom running", n)
+	}
+
+	// teams starting doesn't disturb the zoom rule
+	lister.set("zoom", "teams")
+	watchers[1].CheckNow()
+	zoom := runner.count("zoom")
+	waitForRuns("teams", 3)
+	waitForRuns("zoom", zoom+3)
+	if !watchers[0].Status().Monitoring || !watchers[1].Status().Monitoring {
+		t.Error("both rules should be monitoring with both processes running")
+	}
+}
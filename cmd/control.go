@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"stay-focused/focus"
+)
+
+// controlCommands are the commands accepted on the control socket.
+var controlCommands = map[string]bool{
+	"check":  true,
+	"pause":  true,
+	"resume": true,
+	"status": true,
+}
+
+// controlRequest is a command from the control socket, handled by the main
+// loop which sends the response to reply.
+type controlRequest struct {
+	command string
+	reply   chan<- string
+}
+
+// serveControl listens on the Unix socket at path, readable and writable only
+// by the owner, and passes each command received to requests until ctx is
+// cancelled. Each line sent is a command and gets a one line response, or one
+// line per watcher for status. The returned channel is closed once the socket
+// has been closed and removed.
+func serveControl(ctx context.Context, path string, requests chan<- controlRequest) (<-chan struct{}, error) {
+	// Remove a socket left behind by an instance that didn't shut down
+	// cleanly, but not one still in use
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is in use by another instance", path)
+		}
+		os.Remove(path)
+	}
+
+	ln, err := listenPrivate(path)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("Control socket failed", "path", path, "err", err)
+				}
+				return
+			}
+			go handleControl(ctx, conn, requests)
+		}
+	}()
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	slog.Info("Listening for commands", "socket", path)
+	return done, nil
+}
+
+// handleControl reads commands from conn until it is closed.
+func handleControl(ctx context.Context, conn net.Conn, requests chan<- controlRequest) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		command := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if command == "" {
+			continue
+		}
+		if !controlCommands[command] {
+			fmt.Fprintln(conn, "error: unknown command, expected one of: check, pause, resume, status")
+			continue
+		}
+
+		reply := make(chan string, 1)
+		select {
+		case requests <- controlRequest{command: command, reply: reply}:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case response := <-reply:
+			fmt.Fprintln(conn, response)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// controlStatus describes each watcher on a line for the status command.
+func controlStatus(watchers []*focus.Watcher) string {
+	lines := make([]string, len(watchers))
+	for i, watcher := range watchers {
+		status := watcher.Status()
+		line := strings.Builder{}
+		if status.Name != "" {
+			line.WriteString(status.Name + ": ")
+		}
+		fmt.Fprintf(&line, "device=%s monitoring=%t paused=%t failures=%d", status.Device, status.Monitoring, status.Paused, status.ConsecutiveFailures)
+		if !status.LastRefocus.IsZero() {
+			line.WriteString(" last_refocus=" + status.LastRefocus.Format(time.RFC3339))
+		}
+		if status.LastError != "" {
+			fmt.Fprintf(&line, " last_error=%q", status.LastError)
+		}
+		lines[i] = line.String()
+	}
+	return strings.Join(lines, "\n")
+}
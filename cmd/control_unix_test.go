@@ -0,0 +1,57 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestControlSocketPrivate(t *testing.T) {
+	// A permissive umask mustn't leak into the socket's permissions
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+
+	path := filepath.Join(t.TempDir(), "control.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	requests := make(chan controlRequest)
+	done, err := serveControl(ctx, path, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("control socket permissions = %o, want 600", perm)
+	}
+	if mask := syscall.Umask(0); mask != 0 {
+		t.Errorf("umask left at %o after listening", mask)
+	}
+
+	go func() {
+		req := <-requests
+		req.reply <- "ok " + req.command
+	}()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintln(conn, "check")
+	if reply, err := bufio.NewReader(conn).ReadString('\n'); err != nil || reply != "ok check\n" {
+		t.Errorf("reply = %q, %v, want %q", reply, err, "ok check\n")
+	}
+}
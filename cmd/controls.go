@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"stay-focused/focus"
+)
+
+// listControls prints the controls of each watched camera device and their
+// current values, to find the name to pass to -ctrl.
+func listControls(w io.Writer, watchOpts []*options) error {
+	seen := map[string]bool{}
+	for _, o := range watchOpts {
+		if seen[o.device] {
+			continue
+		}
+		seen[o.device] = true
+
+		if err := focus.CheckDevice(o.device); err != nil {
+			return err
+		}
+		controls, err := focus.ListControls(o.device)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "%s:\n", o.device)
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		for _, c := range controls {
+			value := "-"
+			if c.HasValue {
+				value = fmt.Sprint(c.Value)
+			}
+			line := fmt.Sprintf("\t%s\t%#08x\t(%s)\tvalue=%s", c.Name, c.ID, c.Type, value)
+			switch c.Type {
+			case "int", "menu", "intmenu":
+				line += fmt.Sprintf("\tmin=%d max=%d step=%d default=%d", c.Min, c.Max, c.Step, c.Default)
+			case "bool":
+				line += fmt.Sprintf("\tdefault=%d", c.Default)
+			default:
+				line += "\t"
+			}
+			if c.Inactive {
+				line += " inactive"
+			}
+			fmt.Fprintln(tw, line)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
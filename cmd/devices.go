@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// expandDevices replaces each options whose -device is a glob pattern, ex:
+// /dev/video*, with a copy for each device matching it, so every device is
+// watched and refocused separately. When a pattern matches several devices
+// each copy is named after its device.
+func expandDevices(watchOpts []*options) ([]*options, error) {
+	var expanded []*options
+	for _, o := range watchOpts {
+		if !strings.ContainsAny(o.device, "*?[") {
+			expanded = append(expanded, o)
+			continue
+		}
+
+		devices, err := filepath.Glob(o.device)
+		if err != nil {
+			return nil, fmt.Errorf("device pattern %s: %w", o.device, err)
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("no devices match %s", o.device)
+		}
+		for _, device := range devices {
+			d := *o
+			d.device = device
+			d.devicePattern = o.device
+			if len(devices) > 1 {
+				if o.name != "" {
+					d.name = o.name + " " + device
+				} else {
+					d.name = device
+				}
+			}
+			expanded = append(expanded, &d)
+		}
+	}
+	return expanded, nil
+}
+
+// logDevices logs the devices each -device pattern matched, beyond the banner
+// which -quiet leaves out.
+func logDevices(watchOpts []*options) {
+	var patterns []string
+	matched := map[string][]string{}
+	for _, o := range watchOpts {
+		if o.devicePattern == "" || slices.Contains(matched[o.devicePattern], o.device) {
+			continue
+		}
+		if matched[o.devicePattern] == nil {
+			patterns = append(patterns, o.devicePattern)
+		}
+		matched[o.devicePattern] = append(matched[o.devicePattern], o.device)
+	}
+	for _, pattern := range patterns {
+		slog.Info("Watching devices matching pattern", "pattern", pattern, "devices", matched[pattern])
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandDevices(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"video0", "video2", "media0"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	video0, video2 := filepath.Join(dir, "video0"), filepath.Join(dir, "video2")
+
+	tests := []struct {
+		name    string
+		opts    []*options
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "plain device",
+			opts: []*options{{device: video0}},
+			want: []string{"|" + video0},
+		},
+		{
+			name: "one match keeps the name",
+			opts: []*options{{name: "desk", device: filepath.Join(dir, "video0*")}},
+			want: []string{"desk|" + video0},
+		},
+		{
+			name: "several matches named after their device",
+			opts: []*options{{device: filepath.Join(dir, "video*")}},
+			want: []string{video0 + "|" + video0, video2 + "|" + video2},
+		},
+		{
+			name: "several matches of a named rule",
+			opts: []*options{{name: "desk", device: filepath.Join(dir, "video*")}},
+			want: []string{"desk " + video0 + "|" + video0, "desk " + video2 + "|" + video2},
+		},
+		{
+			name:    "no match",
+			opts:    []*options{{device: filepath.Join(dir, "webcam*")}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expanded, err := expandDevices(tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expandDevices() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, o := range expanded {
+				got = append(got, o.name+"|"+o.device)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("expandDevices() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogDevices(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(previous)
+
+	logDevices([]*options{
+		{device: "/dev/video0", devicePattern: "/dev/video*"},
+		{device: "/dev/video2", devicePattern: "/dev/video*"},
+		{device: "/dev/video4"},
+	})
+	want := `msg="Watching devices matching pattern" pattern=/dev/video* devices="[/dev/video0 /dev/video2]"`
+	if got := logs.String(); strings.Count(got, "\n") != 1 || !strings.Contains(got, want) {
+		t.Errorf("logs = %q, want one line containing %s", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"stay-focused/focus"
+)
+
+// idleSources are the commands tried in turn to read how long the session has
+// been idle, each printing it in milliseconds.
+var idleSources = [][]string{
+	{"dbus-send", "--session", "--print-reply=literal", "--dest=org.freedesktop.ScreenSaver", "/org/freedesktop/ScreenSaver", "org.freedesktop.ScreenSaver.GetSessionIdleTime"},
+	{"xprintidle"},
+}
+
+// screenIdle inhibits refocusing once the user has been idle, without using
+// the keyboard or mouse, for threshold.
+type screenIdle struct {
+	threshold time.Duration
+	command   []string
+}
+
+// newScreenIdle returns an inhibitor for the desktop session's idle time,
+// read from the org.freedesktop.ScreenSaver D-Bus service or xprintidle. If
+// neither works the idle time is ignored and nil is returned.
+func newScreenIdle(threshold time.Duration) focus.Inhibitor {
+	for _, command := range idleSources {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		idle := screenIdle{threshold: threshold, command: command}
+		if _, err := idle.idleTime(); err != nil {
+			slog.Debug("Can't read idle time", "command", command[0], "err", err)
+			continue
+		}
+		return idle
+	}
+	slog.Warn("Can't read the session idle time, ignoring -skip-when-idle")
+	return nil
+}
+
+func (i screenIdle) Inhibited() (bool, error) {
+	idle, err := i.idleTime()
+	if err != nil {
+		return false, err
+	}
+	return idle >= i.threshold, nil
+}
+
+// idleTime runs the idle time command, which prints the idle time in
+// milliseconds, possibly after its type, ex: "uint32 5000".
+func (i screenIdle) idleTime() (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, i.command[0], i.command[1:]...).Output()
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(bytes.TrimSpace(out)))
+	if len(fields) == 0 {
+		return 0, errors.New("no idle time in output")
+	}
+	ms, err := strconv.ParseUint(fields[len(fields)-1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (i screenIdle) String() string {
+	return "idle for " + i.threshold.String()
+}
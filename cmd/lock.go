@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"time"
+
+	"stay-focused/focus"
+)
+
+// lockTimeout bounds how long loginctl may take to report the lock state.
+const lockTimeout = 2 * time.Second
+
+// screenLock inhibits refocusing while the login session is locked, as
+// reported by systemd-logind's LockedHint through loginctl.
+type screenLock struct {
+	path    string
+	session string
+}
+
+// newScreenLock returns an inhibitor for the current login session, or nil if
+// loginctl isn't available or can't report on the session, in which case the
+// lock state is ignored.
+func newScreenLock() focus.Inhibitor {
+	path, err := exec.LookPath("loginctl")
+	if err != nil {
+		slog.Warn("loginctl not found, ignoring -skip-when-locked", "err", err)
+		return nil
+	}
+
+	// "auto" is the session of the caller, or else the user's graphical one
+	session := os.Getenv("XDG_SESSION_ID")
+	if session == "" {
+		session = "auto"
+	}
+	lock := screenLock{path: path, session: session}
+	if _, err := lock.Inhibited(); err != nil {
+		slog.Warn("Can't read the screen lock state, ignoring -skip-when-locked", "session", session, "err", err)
+		return nil
+	}
+	return lock
+}
+
+func (l screenLock) Inhibited() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, l.path, "show-session", l.session, "--property=LockedHint", "--value").Output()
+	if err != nil {
+		return false, err
+	}
+	return string(bytes.TrimSpace(out)) == "yes", nil
+}
+
+func (l screenLock) String() string {
+	return "screen lock"
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// rotatingFile is a log file rotated once it would grow past maxSize bytes.
+// The current file is renamed with a .1 suffix, older ones moving up to .2
+// and so on, keeping at most maxBackups. A maxSize of 0 never rotates.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// openLogFile opens path for appending, creating it if needed.
+func openLogFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if maxSize < 0 || maxBackups < 0 {
+		return nil, fmt.Errorf("log file size and number of backups must not be negative, got %d and %d", maxSize, maxBackups)
+	}
+	f, size, err := openAppend(path)
+	if err != nil {
+		return nil, err
+	}
+	return &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups, file: f, size: size}, nil
+}
+
+// openAppend opens path for appending, creating it if needed, and returns its
+// size.
+func openAppend(path string) (*os.File, int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("opening log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("opening log file: %w", err)
+	}
+	return f, info.Size(), nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		// Keep logging to the current file if rotating fails, ex: it was
+		// removed out from under us
+		if err := r.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error rotating log file: %s\n", err.Error())
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups up by one, dropping the oldest, and starts a new
+// file. The current file is only closed once the new one is open, so if that
+// fails logging carries on to it, rotating again after another maxSize bytes.
+func (r *rotatingFile) rotate() error {
+	if r.maxBackups == 0 {
+		os.Remove(r.path)
+	} else {
+		os.Remove(r.backup(r.maxBackups))
+		for i := r.maxBackups - 1; i >= 1; i-- {
+			os.Rename(r.backup(i), r.backup(i+1))
+		}
+		os.Rename(r.path, r.backup(1))
+	}
+	f, size, err := openAppend(r.path)
+	if err != nil {
+		r.size = 0
+		return err
+	}
+	r.file.Close()
+	r.file, r.size = f, size
+	return nil
+}
+
+func (r *rotatingFile) backup(n int) string {
+	return r.path + "." + strconv.Itoa(n)
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
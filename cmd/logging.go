@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// syslogWriter writes a message to syslog at each priority, as
+// *syslog.Writer does.
+type syslogWriter interface {
+	Debug(msg string) error
+	Info(msg string) error
+	Warning(msg string) error
+	Err(msg string) error
+}
+
+// setupLogging installs the default slog logger at level in format, either
+// "text" or "json", writing to out, or to sys if it isn't nil. When quiet is
+// set the level is raised to at least warn.
+func setupLogging(out io.Writer, sys syslogWriter, level, format string, quiet bool) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q, must be one of: debug, info, warn, error", level)
+	}
+	if quiet && lvl < slog.LevelWarn {
+		lvl = slog.LevelWarn
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: lvl}
+	var buf *syslogBuffer
+	if sys != nil {
+		// syslog timestamps each message itself
+		buf = &syslogBuffer{sys: sys}
+		out = &buf.buf
+		handlerOpts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		}
+	}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(out, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		return fmt.Errorf("invalid log format %q, must be text or json", format)
+	}
+	if buf != nil {
+		handler = syslogHandler{Handler: handler, out: buf}
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// syslogBuffer holds each formatted record until it is sent to syslog.
+type syslogBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	sys syslogWriter
+}
+
+// syslogHandler formats records with Handler and sends each to syslog with
+// the priority matching its level.
+type syslogHandler struct {
+	slog.Handler
+	out *syslogBuffer
+}
+
+func (h syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+
+	h.out.buf.Reset()
+	if err := h.Handler.Handle(ctx, r); err != nil {
+		return err
+	}
+	msg := strings.TrimSuffix(h.out.buf.String(), "\n")
+	switch {
+	case r.Level >= slog.LevelError:
+		return h.out.sys.Err(msg)
+	case r.Level >= slog.LevelWarn:
+		return h.out.sys.Warning(msg)
+	case r.Level >= slog.LevelInfo:
+		return h.out.sys.Info(msg)
+	default:
+		return h.out.sys.Debug(msg)
+	}
+}
+
+func (h syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return syslogHandler{Handler: h.Handler.WithAttrs(attrs), out: h.out}
+}
+
+func (h syslogHandler) WithGroup(name string) slog.Handler {
+	return syslogHandler{Handler: h.Handler.WithGroup(name), out: h.out}
+}
@@ -1,161 +1,549 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/mitchellh/go-ps"
+	"stay-focused/focus"
 )
 
 var (
-	moduleName          string
-	processName         string
-	device              string
-	runningCheckTimeout int
-	refocusTimeout      int
-	useV4l2             bool
+	opts        options
+	runOnce     bool
+	showVersion bool
+	configFile  string
+	logLevel    string
+	logFormat   string
+	quiet       bool
+	verbose     bool
+	metricsAddr string
+	httpAddr    string
+	healthFails int
+	pidfile     string
+	configTest  bool
+	logTarget   string
+	controlPath string
+	logFile     string
+	logMaxSize  int
+	logBackups  int
+	maxRuntime  time.Duration
+
+	// subcommand is set if the first argument names one, ex: generate-systemd
+	subcommand string
+)
+
+// Build metadata, set at build time with -ldflags, ex:
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
 )
 
 func init() {
-	flag.StringVar(&moduleName, "module", "uvcvideo", "The module to check for usage, ex: uvcvideo")
-	flag.StringVar(&processName, "proc", "", "The process name to check if running, ex: /opt/zoom/aomhost. If provided this will be used instead of module")
-	flag.StringVar(&device, "device", "/dev/video0", "The camera device to use")
-	flag.IntVar(&runningCheckTimeout, "check", 1, "How often to check if proc is running in minutes")
-	flag.IntVar(&refocusTimeout, "refocus", 10, "How often to refocus camera in seconds while proc is running")
-	flag.BoolVar(&useV4l2, "v4l2", false, "Use default v4l2-ctl refocus command. If set argument for refocus command is not required.")
+	opts.register(flag.CommandLine)
+	flag.BoolVar(&runOnce, "once", false, "Check once, run the refocus command a single time if in use and exit")
+	flag.BoolVar(&showVersion, "version", false, "Print version information and exit")
+	flag.StringVar(&configFile, "config", "", "Path to a YAML config file setting any of these flags, ex: /etc/stay-focused.yaml")
+	flag.StringVar(&logLevel, "log-level", "info", "Minimum level to log: debug, info, warn, error")
+	flag.StringVar(&logFormat, "log-format", "text", "Log output format: text, json")
+	flag.StringVar(&logTarget, "log-target", "stderr", "Where to send logs: stderr, or syslog to reach syslog or journald with matching priorities")
+	flag.StringVar(&logFile, "log-file", "", "Write logs to this file instead of stderr, ex: /var/log/stay-focused.log")
+	flag.IntVar(&logMaxSize, "log-max-size", 10, "Rotate -log-file once it reaches this many megabytes, 0 to never rotate")
+	flag.IntVar(&logBackups, "log-max-backups", 3, "Number of rotated -log-file files to keep")
+	flag.BoolVar(&verbose, "verbose", false, "Log the result of every check and each refocus loop started, the same as -log-level debug")
+	flag.BoolVar(&quiet, "quiet", false, "Don't print the startup banner and only log warnings and errors")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "Address to serve Prometheus metrics on at /metrics, ex: localhost:9090. Disabled by default")
+	flag.StringVar(&httpAddr, "http-addr", "", "Address to serve JSON status on at /status and a health check at /healthz, ex: localhost:8080. Disabled by default")
+	flag.IntVar(&healthFails, "health-failures", 3, "Report unhealthy from /healthz after this many refocus attempts in a row fail")
+	flag.BoolVar(&configTest, "config-test", false, "Check the flags and config file are valid, print OK or the errors found and exit")
+	flag.StringVar(&controlPath, "control-socket", "", "Listen for commands on this Unix socket: check, pause, resume and status, ex: /run/stay-focused.sock. Disabled by default")
+	flag.DurationVar(&maxRuntime, "max-runtime", 0, "Exit cleanly after running this long, ex: 8h for a temporary session. Disabled by default")
+	flag.StringVar(&pidfile, "pidfile", "", "Write the process ID to this file and refuse to start if another instance holds it, ex: /run/stay-focused.pid")
+}
+
+// parseArgs parses the command line, outside init so tests can register
+// their own flags first.
+func parseArgs() {
+	// A subcommand comes before the flags, which it uses like a normal run
+	if len(os.Args) > 1 && subcommands[os.Args[1]] {
+		subcommand = os.Args[1]
+		flag.CommandLine.Parse(os.Args[2:])
+		return
+	}
 	flag.Parse()
 }
 
+// subcommands lists the subcommands that may be given as the first argument.
+var subcommands = map[string]bool{
+	"generate-systemd": true,
+	"list-controls":    true,
+	"check":            true,
+}
+
 func main() {
-	cxt, cancelMain := context.WithCancel(context.Background())
-	sigchnl := make(chan os.Signal, 1)
-	signal.Notify(sigchnl)
+	os.Exit(run())
+}
+
+// run runs stay-focused and returns the status to exit with, once its
+// deferred cleanup, ex: removing the pidfile, has run.
+func run() int {
+	parseArgs()
+
+	if showVersion {
+		fmt.Printf("stay-focused %s (commit %s, built %s)\n", version, commit, date)
+		return 0
+	}
+
+	if err := applyEnv(flag.CommandLine); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
 
-	var refocusCommand []string
-	if useV4l2 {
-		refocusCommand = []string{"v4l2-ctl", "-d", device, "--set-ctrl", "focus_automatic_continuous=1"}
-	} else if len(os.Args) > 1 {
-		refocusCommand = os.Args[1:]
+	flag.Visit(func(f *flag.Flag) {
+		cmdlineFlags[f.Name] = true
+	})
+
+	opts.command = flag.Args()
+	watchOpts := []*options{&opts}
+	if configFile != "" {
+		var err error
+		if watchOpts, err = configOptions(flag.CommandLine, &opts); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return 1
+		}
 	}
 
-	if len(refocusCommand) == 0 {
-		usage()
-		os.Exit(1)
+	watchOpts, err := expandDevices(watchOpts)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
 	}
 
-	if processName == "" && moduleName == "" {
-		fmt.Println("Error: Either process or module is required")
-		usage()
-		os.Exit(1)
+	if subcommand == "generate-systemd" {
+		unit, err := generateSystemd(watchOpts)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return 1
+		}
+		fmt.Print(unit)
+		return 0
 	}
 
-	recheckInterval := time.Duration(runningCheckTimeout) * time.Minute
-	refocusInterval := time.Duration(refocusTimeout) * time.Second
+	if subcommand == "list-controls" {
+		if err := listControls(os.Stdout, watchOpts); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return 1
+		}
+		return 0
+	}
 
-	startedMsg := strings.Builder{}
-	startedMsg.WriteString("Stay Focus started at " + time.Now().Format(time.RFC1123Z) + ":\n\tDevice: " + device + "\n")
-	if processName != "" {
-		startedMsg.WriteString("\tWatching for process: " + processName + "\n")
-		startedMsg.WriteString("\tChecking if running every: " + recheckInterval.String() + "\n")
-	} else {
-		startedMsg.WriteString("\tWatching module for use: " + moduleName + "\n")
-		startedMsg.WriteString("\tChecking if in use every: " + recheckInterval.String() + "\n")
+	if verbose {
+		if quiet {
+			fmt.Println("Error: -verbose can't be used with -quiet")
+			return 1
+		}
+		logLevel = "debug"
+	}
+	if maxRuntime < 0 {
+		fmt.Printf("Error: max runtime can't be negative, got %s\n", maxRuntime.String())
+		return 1
 	}
-	startedMsg.WriteString("\tRefocus command: " + strings.Join(refocusCommand, " ") + "\n")
-	startedMsg.WriteString("\tWill run refocus command every: " + refocusInterval.String() + "\n")
-	fmt.Println(startedMsg.String())
 
-	ticker := time.NewTicker(recheckInterval)
-	defer ticker.Stop()
+	logOut := io.Writer(os.Stderr)
+	var logSyslog syslogWriter
+	switch logTarget {
+	case "stderr":
+	case "syslog":
+		if logFile != "" {
+			fmt.Println("Error: -log-file can't be used with -log-target syslog")
+			return 1
+		}
+		var err error
+		if logSyslog, err = openSyslog(); err != nil {
+			fmt.Printf("Error: connecting to syslog: %s\n", err.Error())
+			return 1
+		}
+	default:
+		fmt.Printf("Error: invalid log target %q, must be stderr or syslog\n", logTarget)
+		return 1
+	}
+	if logFile != "" {
+		f, err := openLogFile(logFile, int64(logMaxSize)*1024*1024, logBackups)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return 1
+		}
+		defer f.Close()
+		logOut = f
+	}
+	if err := setupLogging(logOut, logSyslog, logLevel, logFormat, quiet); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 1
+	}
 
-	for {
-		select {
-		case <-ticker.C:
-			if (processName != "" && isProcessRunning(processName)) || (moduleName != "" && isModuleInUse(moduleName)) {
-				xcxt, cancelRefocus := context.WithTimeout(cxt, recheckInterval-refocusInterval)
-				defer cancelRefocus()
-				go handleRefocus(xcxt, refocusCommand, refocusInterval)
+	var checkRunner *outputRunner
+	if subcommand == "check" {
+		checkRunner = &outputRunner{}
+		wrapRunner = checkRunner.wrap
+	}
+
+	if configTest {
+		valid := true
+		for _, o := range watchOpts {
+			if _, err := o.watcher(runOnce); err != nil {
+				valid = false
+				if o.name != "" {
+					fmt.Printf("Error: %s: %s\n", o.name, err.Error())
+				} else {
+					fmt.Printf("Error: %s\n", err.Error())
+				}
 			}
-		case s := <-sigchnl:
-			log.Printf("Received signal: %s, will exit now\n", s.String())
-			cancelMain()
-			os.Exit(0)
 		}
+		if !valid {
+			return 1
+		}
+		fmt.Println("OK")
+		return 0
 	}
-}
 
-func isProcessRunning(proc string) bool {
-	procName := strings.ToLower(proc)
+	watchers := make([]*focus.Watcher, len(watchOpts))
+	for i, o := range watchOpts {
+		watcher, err := o.watcher(runOnce)
+		if err != nil {
+			if !errors.Is(err, errNoCommand) {
+				fmt.Printf("Error: %s\n", err.Error())
+			}
+			if errors.Is(err, errNoCommand) || errors.Is(err, focus.ErrNothingToWatch) {
+				usage()
+			}
+			return 1
+		}
+		watchers[i] = watcher
+	}
+	if subcommand == "check" {
+		if !selfTest(os.Stdout, watchOpts, watchers, checkRunner) {
+			return 1
+		}
+		return 0
+	}
 
-	procs, err := ps.Processes()
-	if err != nil {
-		log.Printf("Error reading process list: %v", err)
-		return false
+	if !quiet {
+		for i, o := range watchOpts {
+			fmt.Println(o.banner(watchers[i], runOnce))
+		}
 	}
+	logDevices(watchOpts)
 
-	for _, v := range procs {
-		if strings.ToLower(v.Executable()) == procName {
-			return true
+	if runOnce {
+		inUse, failed := false, false
+		for _, watcher := range watchers {
+			if (watcher.Schedule != nil && !watcher.Schedule.Active(time.Now())) || !watcher.InUse() {
+				continue
+			}
+			inUse = true
+			if err := watcher.Refocus(); err != nil {
+				failed = true
+			}
+		}
+		if failed {
+			return 1
 		}
+		if !inUse {
+			slog.Info("Not in use, nothing to refocus")
+			return 2
+		}
+		return 0
 	}
 
-	return false
-}
+	if pidfile != "" {
+		release, err := writePidfile(pidfile)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return 1
+		}
+		defer release()
+	}
 
-func isModuleInUse(module string) bool {
-	modName := strings.ToLower(module)
+	cxt, cancelMain := context.WithCancel(context.Background())
+	sigchnl, hupchnl, pausechnl, resumechnl := notifySignals()
+
+	go func() {
+		s := <-sigchnl
+		slog.Info("Received signal, will exit now", "signal", s.String())
+		cancelMain()
+	}()
+	// Stopping at the max runtime goes through the same shutdown as a signal,
+	// so a refocus in progress finishes first
+	if maxRuntime > 0 {
+		stopTimer := time.AfterFunc(maxRuntime, func() {
+			slog.Info("Reached max runtime, will exit now", "max_runtime", maxRuntime.String())
+			cancelMain()
+		})
+		defer stopTimer.Stop()
+	}
 
-	file, err := os.Open("/proc/modules")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		s := strings.Split(scanner.Text(), " ")
-		name, used := s[0], s[2]
-		if strings.ToLower(name) == modName {
-			inUse := used != "0"
-			if inUse {
-			} else {
+	// The metrics and status endpoints share a server if given the same address
+	muxes := map[string]*http.ServeMux{}
+	muxFor := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	running := &watcherSet{}
+	if metricsAddr != "" {
+		running.metrics = focus.NewMetrics()
+		muxFor(metricsAddr).Handle("/metrics", running.metrics)
+	}
+	running.set(watchers, watchOpts[0].name != "")
+	if httpAddr != "" {
+		mux := muxFor(httpAddr)
+		mux.HandleFunc("/status", statusHandler(running))
+		mux.HandleFunc("/healthz", healthHandler(running, healthFails))
+	}
+	var servers []<-chan struct{}
+	for addr, mux := range muxes {
+		done, err := serveHTTP(cxt, addr, mux)
+		if err != nil {
+			fmt.Printf("Error: serving HTTP on %s: %s\n", addr, err.Error())
+			return 1
+		}
+		servers = append(servers, done)
+	}
+
+	var controlchnl chan controlRequest
+	if controlPath != "" {
+		controlchnl = make(chan controlRequest)
+		done, err := serveControl(cxt, controlPath, controlchnl)
+		if err != nil {
+			fmt.Printf("Error: control socket: %s\n", err.Error())
+			return 1
+		}
+		servers = append(servers, done)
+	}
+
+	// Tell systemd startup is done and, if it watches for hangs, ping it from
+	// the main loop
+	sdNotify("READY=1")
+	var watchdog <-chan time.Time
+	if interval := watchdogInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
+
+	// On SIGHUP the watchers are stopped and replaced by ones built from the
+	// reloaded config file. If the config can't be loaded the current watchers
+	// keep running.
+	var (
+		runErr error
+		paused bool
+	)
+run:
+	for {
+		runCtx, stopRun := context.WithCancel(cxt)
+		done := make(chan error, 1)
+		go func(watchers []*focus.Watcher) {
+			done <- runWatchers(runCtx, watchers)
+		}(watchers)
+
+		for {
+			select {
+			case runErr = <-done:
+				stopRun()
+				break run
+			case <-pausechnl:
+				paused = setPaused(watchers, paused, true)
+			case <-resumechnl:
+				paused = setPaused(watchers, paused, false)
+			case req := <-controlchnl:
+				switch req.command {
+				case "check":
+					for _, watcher := range watchers {
+						watcher.CheckNow()
+					}
+					req.reply <- "ok"
+				case "pause":
+					paused = setPaused(watchers, paused, true)
+					req.reply <- "ok"
+				case "resume":
+					paused = setPaused(watchers, paused, false)
+					req.reply <- "ok"
+				case "status":
+					req.reply <- controlStatus(watchers)
+				}
+			case <-watchdog:
+				sdNotify("WATCHDOG=1")
+			case <-hupchnl:
+				sdNotify("RELOADING=1")
+				reloaded, rules := reload()
+				sdNotify("READY=1")
+				if reloaded == nil {
+					continue
+				}
+				for _, watcher := range reloaded {
+					if paused {
+						watcher.Pause()
+					}
+				}
+				handOver(watchers, reloaded)
+				stopRun()
+				if runErr = <-done; runErr != nil {
+					break run
+				}
+				watchers = reloaded
+				running.set(watchers, rules)
+				continue run
 			}
-			return inUse
 		}
 	}
 
-	log.Println("Module not found")
-	return false
+	sdNotify("STOPPING=1")
+	cancelMain()
+	for _, done := range servers {
+		<-done
+	}
+
+	if runErr != nil {
+		fmt.Printf("Error: %s\n", runErr.Error())
+		return 1
+	}
+	return 0
 }
 
-func handleRefocus(cxt context.Context, refocusCommand []string, refocusInterval time.Duration) {
-	ticker := time.NewTicker(refocusInterval)
-	defer ticker.Stop()
+// notifySignals relays the signals handled: SIGINT and SIGTERM to stop, SIGHUP
+// to reload and the pause and resume signals. Others, ex: SIGCHLD as commands
+// exit, keep their default behavior.
+func notifySignals() (stop, hup, pause, resume chan os.Signal) {
+	stop, hup = make(chan os.Signal, 1), make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(hup, syscall.SIGHUP)
+	pause, resume = make(chan os.Signal, 1), make(chan os.Signal, 1)
+	notifyPause(pause, resume)
+	return stop, hup, pause, resume
+}
 
-	for {
-		select {
-		case <-cxt.Done():
-			return
-		case <-ticker.C:
-			var cmd *exec.Cmd
-			if len(refocusCommand) >= 2 {
-				cmd = exec.Command(refocusCommand[0], refocusCommand[1:]...)
-			} else {
-				cmd = exec.Command(refocusCommand[0])
+// handOver pairs each reloaded watcher with the current one for the same rule
+// and device, so the reload doesn't look like the camera stopping and starting
+// being used to the hooks.
+func handOver(current, reloaded []*focus.Watcher) {
+	for _, next := range reloaded {
+		for _, watcher := range current {
+			if watcher.Name == next.Name && watcher.Device == next.Device {
+				watcher.HandOver(next)
+				break
 			}
-			if err := cmd.Run(); err != nil {
-				log.Printf("Error running refocus command (%s): %s", strings.Join(refocusCommand, " "), err.Error())
+		}
+	}
+}
+
+// setPaused pauses or resumes every watcher, logging if paused changes, and
+// returns the new state.
+func setPaused(watchers []*focus.Watcher, paused, pause bool) bool {
+	if pause && !paused {
+		slog.Info("Paused, send SIGUSR2 to resume")
+	} else if !pause && paused {
+		slog.Info("Resumed")
+	}
+	for _, watcher := range watchers {
+		if pause {
+			watcher.Pause()
+		} else {
+			watcher.Resume()
+		}
+	}
+	return pause
+}
+
+// runWatchers runs each watcher until ctx is cancelled. The watchers run
+// independently, if one fails the others are stopped and its error returned.
+func runWatchers(ctx context.Context, watchers []*focus.Watcher) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		runErr   error
+		errMutex sync.Mutex
+	)
+	for _, watcher := range watchers {
+		wg.Add(1)
+		go func(watcher *focus.Watcher) {
+			defer wg.Done()
+			if err := watcher.Run(ctx); err != nil {
+				errMutex.Lock()
+				runErr = err
+				errMutex.Unlock()
+				cancel()
 			}
+		}(watcher)
+	}
+	wg.Wait()
+	return runErr
+}
+
+// durationFlag is a flag.Value accepting a Go duration string such as 30s or
+// 2m. For compatibility a bare integer is still accepted and interpreted in
+// unit.
+type durationFlag struct {
+	d    time.Duration
+	unit time.Duration
+}
+
+func (f *durationFlag) String() string {
+	return f.d.String()
+}
+
+func (f *durationFlag) Set(value string) error {
+	if n, err := strconv.Atoi(value); err == nil {
+		f.d = time.Duration(n) * f.unit
+		return nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	f.d = d
+	return nil
+}
+
+// listFlag is a flag.Value collecting a list of strings. The flag may be
+// repeated and each value may itself be a comma separated list.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, splitList(value)...)
+	return nil
+}
+
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(value string) []string {
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
 		}
 	}
+	return list
 }
 
 func usage() {
@@ -167,7 +555,7 @@ hopefully tell your camera to refocus video.
 
 Usage:
 
-	stay-focused -proc {name} -check {minutes} -refocus {seconds} refocus command --with args
+	stay-focused -proc {name} -check {interval} -refocus {interval} refocus command --with args
 
 Examples:
 
@@ -178,13 +566,258 @@ Examples:
 Flags:
 
 	proc:		The name of the process to monitor for as would show up when running "ps", 
-			example: /opt/zoom/aomhost
-	module:		The name of the module to monitor for use instead of process
-	device:		The device to refocus if using default v4l2 command but needing different device
-	check:		The interval in minutes to check for proc to be running
-	refocus:	The interval in seconds to execute refocus command
+			example: /opt/zoom/aomhost. Repeat the flag or comma separate names to
+			watch several processes, refocus runs when any of them is running.
+	proc-match:	How -proc names are compared to process executables:
+			  exact:     case insensitive exact match (default)
+			  substring: case insensitive substring match
+			  regex:     Go regular expression, ex: ^chrome$
+	proc-match-cmdline:
+			Match -proc against the full command line from /proc/<pid>/cmdline
+			instead of the executable name. Linux only and more expensive, best
+			combined with -proc-match substring or regex.
+	own-procs-only:	Only match -proc against processes run by the same user as stay-focused,
+			read from the Uid line of /proc/<pid>/status, so another user's Zoom on a
+			shared machine doesn't refocus your camera. Linux only, elsewhere every
+			user's processes are matched.
+	pid:		A process ID to watch, ex: $(pgrep -n zoom), refocusing while it is running and
+			stopping once it exits. Cheaper and more precise than -proc as the process
+			list isn't read, but only that one process is watched.
+	module:		The name of the module to monitor for use instead of process. May be a comma
+			separated list, ex: uvcvideo,v4l2loopback
+	modules-path:	The file listing the loaded modules and their usage counts, in the /proc/modules
+			format. Defaults to /proc/modules, set it when that isn't the host's, ex: in a
+			container with the host's mounted at /host/proc/modules.
+	device:		The device to refocus if using default v4l2 command but needing different device.
+			May be a glob pattern, ex: '/dev/video*', when a camera has several device
+			nodes and it isn't clear which one apps use. The pattern is matched once at
+			startup and each device found is watched and refocused on its own, as if by
+			a separate rule named after the device. Best combined with -detect fd so
+			only the devices actually open are refocused.
+	detect:		Comma separated list of ways to detect the camera being in use:
+			  proc:   one of the -proc processes is running
+			  module: one of the -module modules has a non-zero usage count
+			  fd:     any process has the -device open, found via /proc/*/fd
+			  fuser:  any process has the -device open, found by running fuser.
+			          Falls back to fd if fuser isn't installed.
+			  event:  like proc, but also checks right away when a -proc process
+			          starts or exits using the Linux proc connector rather than
+			          waiting for the next check. Needs root or CAP_NET_ADMIN,
+			          otherwise falls back to polling like proc.
+			  pid:    the -pid process is running
+			  audio:  any application is recording from a microphone, found with
+			          pactl for PulseAudio or PipeWire. Catches meetings in a
+			          browser tab, ex: -detect proc,audio. Reports not in use,
+			          after a warning, if pactl or the audio server is missing.
+			Defaults to pid if -pid is given, proc if -proc is given plus module if
+			-module is set.
+	detect-timeout:	How long detecting whether the camera is in use may take, default 10s, ex: on
+			a heavily loaded system where reading the process list stalls. A check
+			that takes longer is skipped, carrying on as before, with a warning. 0
+			waits forever.
+	match-mode:	Either "any" (default) to refocus when any detection mode reports in use,
+			or "all" to require every mode to report in use before refocusing
+	check:		The interval to check for proc to be running, as a duration (ex: 30s, 2m) or
+			a whole number of minutes. Must be greater than the refocus interval.
+	poll-proc-interval, poll-module-interval:
+			Check -proc and -module on their own cadence instead of every -check, ex:
+			-poll-proc-interval 5s -poll-module-interval 5m to notice an app starting
+			quickly but read the modules rarely. A longer interval reuses the last result
+			in the checks in between, a shorter one is polled while the camera isn't in
+			use and checks right away once it finds it in use. Combined per -match-mode
+			as usual. Both default to -check.
+	refocus:	The interval to execute refocus command, as a duration (ex: 500ms, 1m30s)
+			or a whole number of seconds
+	battery-refocus:
+			How often to refocus instead of -refocus while the laptop runs on battery,
+			ex: 30s, read from /sys/class/power_supply. Must be less than the check
+			interval. Linux only, ignored when there is no power supply information.
+	workdir:	Directory to run the refocus command and hooks in, ex: for a script using
+			relative paths. Defaults to the directory stay-focused was started in.
+	env:		An environment variable to set for the refocus command and hooks as KEY=VALUE,
+			ex: PATH=/opt/camera/bin:/usr/bin. Repeat the flag or comma separate to set
+			several. They are added to stay-focused's own environment, replacing
+			variables of the same name.
+	clean-env:	Start the refocus command and hooks with only the -env variables, without
+			stay-focused's own environment
+	user:		Run the refocus command and hooks as this user, by name or uid, ex: nobody.
+			stay-focused itself keeps running as root, which module, fd and event
+			detection and the native ioctl may need, but the commands it runs don't
+			get root's privileges. Starting fails if stay-focused isn't root or the
+			user doesn't exist. Not on Windows.
+	group:		Run the refocus command and hooks with this group, by name or gid, ex: video
+			to keep access to the camera. Defaults to the -user's primary group.
+	nice:		Run the refocus command and hooks with nice -n, ex: 10, at a lower scheduling
+			priority so they don't compete with a meeting app on a loaded machine. From
+			-20 to 19, negative values need root. Default 0 leaves the priority as is.
+			Unix only.
+	cmd-timeout:	How long the refocus command may run before it is killed, ex: 5s. This
+			should be kept well under the refocus interval.
+	cooldown:	How long the camera must be found unused before refocusing stops and -on-stop
+			runs, ex: 2m. Debounces apps that linger or restart at the end of a meeting.
+			The camera is checked every -check interval so the cooldown is rounded up
+			to a multiple of it.
+	warmup:		Delay before the first refocus after the camera starts being used, ex: 3s, for
+			cameras that ignore focus commands while starting up. Later refocuses follow
+			the refocus interval. Must be less than the check interval.
+	initial-delay:	Wait this long after starting before the first check, ex: 30s, when started at
+			boot or login so the desktop session and camera are ready first. Not
+			applied again when the config file is reloaded or with -once.
+	burst:		Refocus this many times -burst-gap apart as soon as the camera starts being
+			used, or after -warmup if set, then carry on at the refocus interval, for
+			cameras that need a few nudges to lock focus, ex: 3. Stops early if the
+			matched process exits.
+	burst-gap:	Delay between the -burst refocuses, default 500ms
+	jitter:		Randomize each refocus interval by up to this percentage either way, ex: 10 for
+			10s ± 1s. Helps spread out refocus commands when several instances or rules
+			share a camera or USB bus. Defaults to 0, no jitter.
+	max-backoff:	When the refocus command fails the delay before the next attempt doubles each
+			time, starting from the refocus interval, until it succeeds again. This caps
+			the delay, ex: 5m. Defaults to the check interval.
+	on-error:	What to do each time a refocus attempt fails:
+			  backoff:  double the delay before the next attempt, up to -max-backoff (default)
+			  continue: keep trying every refocus interval
+			  exit:     exit with status 1 right away, so a supervisor can restart
+			            stay-focused
+			With backoff and continue, -max-failures and -failure-policy still apply
+			once enough attempts in a row have failed. With exit they are never reached.
+	stale-after:	Log a warning when the camera has been in use this long without a successful
+			refocus, ex: 5m, and again after the next success if it goes stale again. The
+			time of the last success is reported as last_success by /status and as
+			stay_focused_last_success_timestamp_seconds by /metrics. Disabled by default.
+	max-failures:	After this many refocus attempts in a row fail apply -failure-policy. Disabled
+			by default.
+	failure-policy:	What to do after -max-failures, either "exit" (default) to exit with status 1,
+			or "alert" to run -alert-cmd once and carry on. It runs again if refocusing
+			succeeds and then fails -max-failures times again. Exiting lets a supervisor
+			restart stay-focused, ex: with systemd Restart=on-failure or Restart=always.
+			Set RestartSec and StartLimitBurst so a wedged camera doesn't cause a
+			restart loop, systemd stops restarting once the start limit is hit.
+	alert-cmd:	Shell command run by the alert failure policy, ex: 'notify-send "refocus failing"'
+	pre-hook:	Shell command to run right before each refocus, ex: to flash an LED. It is
+			given -cmd-timeout to finish, failures are logged but don't stop the refocus
+			unless -hook-strict is set.
+	post-hook:	Shell command to run right after each refocus, whether it succeeded or not
+	hook-strict:	Skip the refocus when -pre-hook fails
+	on-start:	Shell command to run once when the camera starts being used, ex: to turn on a
+			recording light or mute notifications
+	on-stop:	Shell command to run once when the camera stops being used, when paused and
+			when stay-focused exits while the camera is in use
+	notify:		Show a desktop notification when the camera starts being used and refocusing
+			begins, and when it ends. Uses notify-send, nothing is shown if it isn't
+			installed or there is no notification daemon running.
+	once:		Check once, run the refocus command a single time if in use and exit.
+			Exits 0 if refocused, 2 if not in use, 1 if the refocus command failed.
+	schedule:	Only watch for the camera during these times, in local time. Outside them
+			stay-focused keeps running but doesn't check or refocus. One or more windows
+			separated by semicolons, each an optional list of days and a time range, ex:
+			  Mon-Fri 09:00-17:00
+			  Mon,Wed,Fri 08:30-12:00; Sat-Sun 10:00-14:00
+			  22:00-02:00 (every day, running past midnight)
+			The schedule is checked every -check interval.
+	skip-when-locked:
+			Don't check or refocus while the screen is locked, as reported by
+			systemd-logind through loginctl for the current session. If the lock state
+			can't be read, ex: with no login session, a warning is logged and the flag
+			is ignored.
+	skip-when-idle:	Don't check or refocus once the keyboard and mouse have been idle this long,
+			ex: 10m, and start again on the next check after they are used. The idle
+			time is read from the desktop's org.freedesktop.ScreenSaver D-Bus service,
+			or from xprintidle on X11. If neither works a warning is logged and the
+			flag is ignored.
+	always:		Refocus every refocus interval forever, without checking whether the camera is
+			in use, ex: for a fixed installation. -proc and -module aren't needed.
+	dry-run:	Log the refocus command each interval instead of running it. Detection
+			still runs so the trigger logic can be confirmed.
+	version:	Print version, git commit and build date and exit
+	native:		Refocus by setting the continuous autofocus control on the device directly
+			with an ioctl, without running v4l2-ctl. If the ioctl fails, for example
+			because the camera doesn't support the control, the refocus command (or the
+			default v4l2-ctl command if none is given) is used instead. Linux only.
+	ctrl-mode:	What native sets. auto (default) enables continuous autofocus. nudge is for
+			cameras with only manual focus: focus_absolute is moved one step from its
+			current value, down instead at the top of its range, and set back 100ms
+			later, which makes some cameras refocus.
+	force:		With native, the focus control is read first and only set when it isn't
+			already enabled. Set this to always write it, for cameras that misreport
+			their state.
+	uevent:		Also check right away when a video device is plugged in or removed, using the
+			kernel uevent netlink socket, instead of waiting for the next check. Apps
+			opening the camera are still found by polling every -check interval. Falls
+			back to polling only if the socket can't be opened. Linux only.
+	config:		Path to a YAML config file, see below
+	config-test:	Check the flags and config file without starting, then print OK or the errors
+			found and exit with status 1 if there are any, ex: before reloading:
+			  stay-focused -config /etc/stay-focused.yaml -config-test && systemctl reload stay-focused
+			This runs the same checks as starting up: the refocus command is found, the
+			device exists, the intervals make sense and patterns compile.
+	log-level:	Minimum level to log: debug, info (default), warn or error. Debug logs every
+			refocus attempt, info only when the camera starts or stops being used.
+	log-format:	Log output format: text (default) or json
+	log-target:	Where to send logs: stderr (default), or syslog to send them to the local
+			syslog daemon or journald with the priority matching each level, err,
+			warning, info or debug, ex: for journalctl -p warning. Not on Windows.
+	log-file:	Write logs to this file instead of stderr, ex: /var/log/stay-focused.log. The
+			startup banner is still printed to stdout.
+	log-max-size:	Rotate -log-file once it would grow past this many megabytes, default 10.
+			The file is renamed with a .1 suffix, older ones to .2 and so on. 0 never
+			rotates, ex: when using logrotate.
+	log-max-backups:
+			Number of rotated log files to keep, default 3. The oldest is removed
+			when rotating; with 0 the log file is simply started over.
+	quiet:		Don't print the startup banner and only log warnings and errors, the same
+			as -log-level warn. A higher -log-level still applies.
+	verbose:	Log what every check found, whether in use and what matched, and each refocus
+			loop started, to see why refocusing isn't happening. The same as -log-level
+			debug, off by default.
+	metrics-addr:	Address to serve Prometheus metrics on at /metrics, ex: localhost:9090.
+			Reports refocus attempts, failures by exit status, whether the camera is
+			being refocused and how long refocusing takes. Disabled by default.
+	http-addr:	Address to serve JSON status on at /status, ex: localhost:8080. With rules in the
+			config file /status returns a list with the status of each rule. A health
+			check is served at /healthz, returning 503 when refocusing keeps failing.
+	control-socket:	Listen for commands on this Unix socket, ex: /run/stay-focused.sock, one per
+			line, each answered with a line. Only the owner may connect. Commands:
+			  check:  check whether the camera is in use right away
+			  pause:  pause refocusing, like SIGUSR1
+			  resume: resume refocusing, like SIGUSR2
+			  status: print a line with the state of each rule
+			ex: echo check | socat - UNIX-CONNECT:/run/stay-focused.sock
+	pidfile:	Write the process ID to this file, ex: /run/stay-focused.pid. The file is locked
+			while running and stay-focused refuses to start if another instance holds the
+			lock. It is removed on shutdown. Not used with -once.
+	max-runtime:	Exit after running this long, ex: 8h, so a temporary or forgotten instance
+			doesn't run forever. Shuts down like SIGTERM, letting a refocus in progress
+			finish. Disabled by default
+	health-failures:
+			Number of refocus attempts in a row that must fail before /healthz reports
+			unhealthy, default 3
 	v4l2:		If you use v4l2-ctl to control your camera this flag will use the 
 				standard/common command to refocus your camera.
+	ctrl:		A v4l2 control for v4l2-ctl to set instead of the default, as name=value, ex:
+			focus_auto=1 on older kernels or focus_absolute=250. Repeat the flag or comma
+			separate controls to set several. Implies -v4l2. With -native the controls
+			are only used by the fallback command. List your camera's controls with:
+			  v4l2-ctl -d /dev/video0 --list-ctrls
+	shell:		Run the refocus command given as a single -cmd string with the shell, sh -c
+			(cmd /C on Windows), instead of as arguments, ex:
+			  -shell -cmd 'v4l2-ctl -d /dev/video0 --set-ctrl focus_auto=1 && logger refocused'
+			The string is interpreted by the shell every refocus, so only use -shell with
+			a command you wrote yourself and never one built from untrusted input, ex: a
+			config file others can write to. Without -shell the command arguments are
+			run directly and nothing in them is expanded.
+	cmd:		The refocus command for -shell
+	cmd-file:	Read the refocus command from a file instead, ex: /etc/stay-focused/refocus.cmd,
+			or from stdin with -. Each line is one argument of the command, or with -shell
+			the whole file is the script to run; blank lines and lines starting with #
+			are skipped. Read and checked at startup and on reload, and templates
+			such as {{.Device}} are expanded as in the arguments.
+	fallback-cmd:	Shell commands to try, in order, when the refocus command fails, for a camera
+			that needs one of several commands, ex:
+			  -fallback-cmd 'v4l2-ctl --set-ctrl focus_auto=1,uvc-util -I 0 -s auto-focus=true'
+			Each refocus stops at the first command that works and that one is used from then
+			on, until it fails and they are all tried again. May be repeated or comma
+			separated, so the commands themselves can't contain commas.
 
 Using v4l2-ctl:
 	If you enable the v4l2 flag the following command will be used to refocus your camera. 
@@ -192,10 +825,94 @@ Using v4l2-ctl:
 
 		v4l2-ctl -d /dev/video0 --set-ctrl focus_automatic_continuous=1
 
+macOS, Windows and other platforms:
+	Only the proc and fuser detection modes are available. -module, -v4l2 and -native are Linux
+	only and a refocus command must be given, ex: with uvc-util on macOS
+
+		stay-focused -proc zoom.us -check 30s -refocus 10s uvc-util -I 0 -s auto-focus=true
+
+	On Windows process names match with or without .exe and hooks are run with cmd /C, ex:
+
+		stay-focused -proc zoom -check 30s -refocus 10s powershell -File C:\refocus.ps1
+
+Config file:
+	Any of the flags above can instead be set in a YAML file passed with -config, using the flag
+	name as the key. The refocus command can be set with the "command" key. Flags given on the
+	command line override values from the file.
+
+		proc: [zoom, teams]
+		check: 30s
+		refocus: 10s
+		command: [v4l2-ctl, -d, /dev/video0, --set-ctrl, focus_automatic_continuous=1]
+
+	To watch several cameras or apps each with their own settings, list them under "rules". Each
+	rule runs independently and takes the same keys, plus an optional "name" used in logs. Values
+	not set in a rule are taken from the top level of the file and the command line.
+
+		check: 1m
+		rules:
+		  - name: zoom
+		    proc: zoom
+		    device: /dev/video0
+		    v4l2: true
+		  - name: capture
+		    detect: fd
+		    device: /dev/video1
+		    refocus: 30s
+		    command: [/usr/local/bin/refocus-capture, /dev/video1]
+
+	Send SIGUSR1 to pause refocusing, ex: while recording with focus locked manually, and SIGUSR2
+	to resume. While paused the camera is not checked and no refocus command runs.
+
+	Send SIGHUP to reload the config file without restarting, ex: systemctl reload stay-focused.
+	Watchers are rebuilt with the new settings, if the file isn't valid the current settings are
+	kept. The logging, metrics and HTTP settings can't be changed this way and need a restart.
+
+Environment variables:
+	Each flag can also be set with an environment variable named STAY_FOCUSED_ followed by the
+	flag name in upper case with dashes replaced by underscores, ex: STAY_FOCUSED_DEVICE,
+	STAY_FOCUSED_PROC, STAY_FOCUSED_CHECK, STAY_FOCUSED_CMD_TIMEOUT. Values take the same form as
+	the flag, ex: STAY_FOCUSED_V4L2=true. Command line flags override environment variables,
+	which override the config file.
+
+Subcommands:
+
+	generate-systemd
+			Print a systemd unit running stay-focused with the flags and command given
+			after it, bound to the camera device so it starts when the camera is plugged
+			in, ex:
+
+		stay-focused generate-systemd -proc zoom -v4l2 > /etc/systemd/system/stay-focused.service
+
+			The unit is Type=notify: stay-focused tells systemd once it has started and
+			pings the systemd watchdog, so it is restarted if it hangs for WatchdogSec.
+			Outside systemd, without NOTIFY_SOCKET set, neither is done.
+
+	list-controls
+			Print the controls of the camera set with -device, or of each rule's device
+			in the config file, with their current values, to find the name to use with
+			-ctrl or to diagnose "unknown control" errors. Linux only, ex:
+
+		stay-focused list-controls -device /dev/video2
+
+	check
+			Check whether the camera is in use and refocus it once either way, printing the
+			commands run with their output and PASS or FAIL, then exit. Exits with status 1
+			if refocusing failed, ex:
+
+		stay-focused check -proc zoom -v4l2
+
 Arguments:
 
 	After the flags are set (all are optional), provide the command you would run to refocus your 
 	camera. 
 
+	The command arguments, the -cmd string and the config file command may use these template
+	variables, filled in from the settings of each rule:
+	  {{.Device}}  the -device, ex: /dev/video0
+	  {{.Proc}}    the -proc processes, comma separated
+	  {{.Module}}  the -module modules, comma separated
+	ex: stay-focused -device /dev/video2 -proc zoom v4l2-ctl -d '{{.Device}}' --set-ctrl focus_auto=1
+
 `)
 }
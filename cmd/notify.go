@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os/exec"
+	"time"
+
+	"stay-focused/focus"
+)
+
+// notifyTimeout bounds how long notify-send may take, it can hang when there
+// is no notification daemon.
+const notifyTimeout = 5 * time.Second
+
+// desktopNotifier shows notifications with notify-send, which talks to the
+// freedesktop notification daemon over D-Bus.
+type desktopNotifier struct {
+	path string
+}
+
+// newDesktopNotifier returns a notifier using notify-send, or nil if it isn't
+// installed so notifications are silently skipped.
+func newDesktopNotifier() focus.Notifier {
+	path, err := exec.LookPath("notify-send")
+	if err != nil {
+		slog.Debug("notify-send not found, desktop notifications disabled", "err", err)
+		return nil
+	}
+	return desktopNotifier{path: path}
+}
+
+// Notify runs notify-send in the background, failures are only logged at debug
+// level as there may be no notification daemon.
+func (n desktopNotifier) Notify(summary, body string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		if out, err := exec.CommandContext(ctx, n.path, "--app-name=stay-focused", summary, body).CombinedOutput(); err != nil {
+			slog.Debug("Error showing desktop notification", "output", string(out), "err", err)
+		}
+	}()
+}
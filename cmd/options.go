@@ -0,0 +1,525 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"stay-focused/focus"
+)
+
+// defaultModule is the module watched by default, the USB video class driver.
+const defaultModule = "uvcvideo"
+
+// Native controller modes set with -ctrl-mode.
+const (
+	ctrlModeAuto  = "auto"
+	ctrlModeNudge = "nudge"
+)
+
+// defaultModulesPath is where the loaded modules are listed by default.
+const defaultModulesPath = "/proc/modules"
+
+// errNoCommand is returned when no refocus command was given, which is
+// reported by printing the usage.
+var errNoCommand = errors.New("refocus command is required")
+
+// options holds the settings for a single watcher, set from the command line
+// flags or from a rule in the config file.
+type options struct {
+	name             string
+	moduleName       string
+	modulesPath      string
+	processNames     listFlag
+	pid              int
+	device           string
+	checkInterval    durationFlag
+	procInterval     time.Duration
+	moduleInterval   time.Duration
+	refocusEvery     durationFlag
+	batteryRefocus   time.Duration
+	useV4l2          bool
+	controls         listFlag
+	workdir          string
+	env              listFlag
+	cleanEnv         bool
+	runUser          string
+	runGroup         string
+	nice             int
+	shell            bool
+	shellCommand     string
+	cmdFile          string
+	fallbackCommands listFlag
+	cmdTimeout       time.Duration
+	maxBackoff       time.Duration
+	cooldown         time.Duration
+	jitter           float64
+	warmup           time.Duration
+	initialDelay     time.Duration
+	burst            int
+	burstGap         time.Duration
+	onError          string
+	staleAfter       time.Duration
+	maxFailures      int
+	failurePolicy    string
+	alertCommand     string
+	preHook          string
+	postHook         string
+	hookStrict       bool
+	onStart          string
+	onStop           string
+	notify           bool
+	always           bool
+	schedule         string
+	skipWhenLocked   bool
+	skipWhenIdle     time.Duration
+	dryRun           bool
+	matchMode        string
+	detectModes      listFlag
+	detectTimeout    time.Duration
+	procMatchMode    string
+	procMatchCmdline bool
+	ownProcsOnly     bool
+	useNative        bool
+	forceSet         bool
+	ctrlMode         string
+	uevents          bool
+
+	// command is the refocus command given as arguments or in the config file
+	command []string
+	// devicePattern is the -device glob pattern device was matched by, if any
+	devicePattern string
+}
+
+// register defines the watcher flags on fs, setting their defaults.
+func (o *options) register(fs *flag.FlagSet) {
+	o.checkInterval = durationFlag{d: time.Minute, unit: time.Minute}
+	o.refocusEvery = durationFlag{d: 10 * time.Second, unit: time.Second}
+
+	fs.StringVar(&o.moduleName, "module", defaultModule, "The module to check for usage, ex: uvcvideo. May be a comma separated list to watch several")
+	fs.StringVar(&o.modulesPath, "modules-path", defaultModulesPath, "The file listing the loaded modules and their usage counts, ex: the host's /proc/modules mounted into a container")
+	fs.Var(&o.processNames, "proc", "The process name to check if running, ex: /opt/zoom/aomhost. May be repeated or comma separated to watch several. If provided this will be used instead of module")
+	fs.IntVar(&o.pid, "pid", 0, "A process ID to watch, refocusing while it runs, in place of -proc")
+	fs.StringVar(&o.device, "device", "/dev/video0", "The camera device to use. May be a glob pattern, ex: '/dev/video*', to watch and refocus every matching device")
+	fs.Var(&o.checkInterval, "check", "How often to check if proc is running, as a duration (ex: 30s, 2m) or in minutes")
+	fs.DurationVar(&o.procInterval, "poll-proc-interval", 0, "How often to look for -proc when it should differ from -check, ex: 5s to notice it starting sooner. Defaults to -check")
+	fs.DurationVar(&o.moduleInterval, "poll-module-interval", 0, "How often to check -module usage when it should differ from -check, ex: 5m to read it rarely. Defaults to -check")
+	fs.Var(&o.refocusEvery, "refocus", "How often to refocus camera while proc is running, as a duration (ex: 500ms, 1m30s) or in seconds")
+	fs.DurationVar(&o.batteryRefocus, "battery-refocus", 0, "How often to refocus while running on battery, ex: 30s. Defaults to the -refocus interval (Linux only)")
+	fs.BoolVar(&o.useV4l2, "v4l2", false, "Use default v4l2-ctl refocus command. If set argument for refocus command is not required.")
+	fs.Var(&o.controls, "ctrl", "A v4l2 control to set as name=value, ex: focus_auto=1, in place of the default with -v4l2. May be repeated or comma separated. Implies -v4l2")
+	fs.BoolVar(&o.shell, "shell", false, "Run the -cmd string with the shell, allowing pipes, && and other shell syntax")
+	fs.Var(&o.fallbackCommands, "fallback-cmd", "Shell commands to try in order when the refocus command fails, the first that works is used from then on. May be repeated or comma separated, ex: 'v4l2-ctl --set-ctrl focus_auto=1'")
+	fs.StringVar(&o.cmdFile, "cmd-file", "", "Read the refocus command from this file, one argument per line, or the shell script to run with -shell. - reads it from stdin")
+	fs.StringVar(&o.shellCommand, "cmd", "", "Refocus command run by the shell with -shell, in place of the command arguments, ex: 'v4l2-ctl --set-ctrl focus_auto=1 && logger refocused'")
+	fs.StringVar(&o.workdir, "workdir", "", "Directory to run the refocus command and hooks in. Defaults to the current directory")
+	fs.Var(&o.env, "env", "An environment variable for the refocus command and hooks as KEY=VALUE, ex: PATH=/opt/camera/bin:/usr/bin. May be repeated or comma separated")
+	fs.BoolVar(&o.cleanEnv, "clean-env", false, "Run the refocus command and hooks with only the -env variables instead of adding them to the current environment")
+	fs.StringVar(&o.runUser, "user", "", "Run the refocus command and hooks as this user, by name or uid, when started as root")
+	fs.IntVar(&o.nice, "nice", 0, "Raise the niceness of the refocus command and hooks by this much, ex: 10 so they don't compete with other apps for CPU. Unix only")
+	fs.StringVar(&o.runGroup, "group", "", "Run the refocus command and hooks with this group, by name or gid, when started as root. Defaults to the -user's group")
+	fs.DurationVar(&o.cmdTimeout, "cmd-timeout", focus.DefaultCmdTimeout, "How long to let the refocus command run before killing it, ex: 5s")
+	fs.DurationVar(&o.cooldown, "cooldown", 0, "How long the camera must be unused before refocusing stops and -on-stop runs, ex: 2m")
+	fs.DurationVar(&o.warmup, "warmup", 0, "Delay before the first refocus after the camera starts being used, in place of the refocus interval, ex: 3s")
+	fs.DurationVar(&o.initialDelay, "initial-delay", 0, "Wait this long after starting before the first check, ex: 30s")
+	fs.IntVar(&o.burst, "burst", 0, "Refocus this many times in quick succession when the camera starts being used, after any -warmup")
+	fs.DurationVar(&o.burstGap, "burst-gap", 500*time.Millisecond, "Delay between the -burst refocuses, ex: 500ms")
+	fs.Float64Var(&o.jitter, "jitter", 0, "Randomize each refocus interval by up to this percentage either way, ex: 10")
+	fs.DurationVar(&o.maxBackoff, "max-backoff", 0, "Longest delay between refocus attempts while they keep failing, ex: 5m. Defaults to the check interval")
+	fs.StringVar(&o.onError, "on-error", focus.OnErrorBackoff, "What to do after a refocus attempt fails: backoff to retry less often, continue to retry every refocus interval, or exit with an error")
+	fs.DurationVar(&o.staleAfter, "stale-after", 0, "Log a warning when the camera has been in use this long without a successful refocus, ex: 5m. Disabled by default")
+	fs.IntVar(&o.maxFailures, "max-failures", 0, "Apply -failure-policy after this many refocus attempts in a row fail. Disabled by default")
+	fs.StringVar(&o.failurePolicy, "failure-policy", focus.FailureExit, "What to do after -max-failures: exit with an error, or alert by running -alert-cmd")
+	fs.StringVar(&o.alertCommand, "alert-cmd", "", "Shell command run by the alert -failure-policy, ex: 'notify-send \"Camera refocus failing\"'")
+	fs.StringVar(&o.preHook, "pre-hook", "", "Shell command to run right before each refocus")
+	fs.StringVar(&o.postHook, "post-hook", "", "Shell command to run right after each refocus")
+	fs.BoolVar(&o.hookStrict, "hook-strict", false, "Skip the refocus if -pre-hook fails")
+	fs.StringVar(&o.onStart, "on-start", "", "Shell command to run once when the camera starts being used")
+	fs.StringVar(&o.onStop, "on-stop", "", "Shell command to run once when the camera stops being used")
+	fs.BoolVar(&o.notify, "notify", false, "Show a desktop notification with notify-send when refocusing starts and stops")
+	fs.BoolVar(&o.always, "always", false, "Refocus every refocus interval regardless of whether the camera is in use, without -proc or -module")
+	fs.StringVar(&o.schedule, "schedule", "", "Only watch during these local times, ex: 'Mon-Fri 09:00-17:00'. Several windows may be separated by semicolons")
+	fs.BoolVar(&o.skipWhenLocked, "skip-when-locked", false, "Don't refocus while the screen is locked, using loginctl. Ignored if the lock state can't be read")
+	fs.DurationVar(&o.skipWhenIdle, "skip-when-idle", 0, "Don't refocus once the keyboard and mouse have been idle this long, ex: 10m. Ignored if the idle time can't be read")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Log the refocus command instead of running it")
+	fs.StringVar(&o.matchMode, "match-mode", focus.MatchAny, "Refocus when any or all of the process and module checks are in use: any, all")
+	fs.Var(&o.detectModes, "detect", "Comma separated detection modes to use: proc, module, fd, fuser, event, audio, pid. Defaults to pid, proc and/or module based on -pid, -proc and -module")
+	fs.DurationVar(&o.detectTimeout, "detect-timeout", 10*time.Second, "Give up on a check if detecting whether the camera is in use takes longer than this, ex: 10s. 0 waits forever")
+	fs.StringVar(&o.procMatchMode, "proc-match", focus.ProcMatchExact, "How -proc names are matched against process executables: exact, substring, regex")
+	fs.BoolVar(&o.ownProcsOnly, "own-procs-only", false, "Only match -proc against processes run by the same user as stay-focused, ignoring other users' (Linux only)")
+	fs.BoolVar(&o.procMatchCmdline, "proc-match-cmdline", false, "Match -proc against the full process command line instead of the executable name (Linux only)")
+	fs.BoolVar(&o.useNative, "native", false, "Refocus by setting the focus control with an ioctl instead of running a command. The command is used as a fallback if the ioctl fails")
+	fs.BoolVar(&o.uevents, "uevent", false, "Also check right away when the -device camera is added or removed, using kernel uevents (Linux only)")
+	fs.StringVar(&o.ctrlMode, "ctrl-mode", ctrlModeAuto, "How -native refocuses: auto to enable continuous autofocus, or nudge to step focus_absolute and back for cameras with only manual focus")
+	fs.BoolVar(&o.forceSet, "force", false, "With -native, set the focus control every time even if it already has the desired value")
+}
+
+// watcher validates the options and builds the watcher they describe. When
+// once is set the intervals aren't used and so aren't checked.
+func (o *options) watcher(once bool) (*focus.Watcher, error) {
+	if !focus.ProcFSSupported {
+		switch {
+		case o.useV4l2, len(o.controls) > 0:
+			return nil, errors.New("-v4l2 and -ctrl are only supported on Linux, give a refocus command instead")
+		case o.useNative:
+			return nil, errors.New("-native is only supported on Linux, give a refocus command instead")
+		case o.moduleName != defaultModule:
+			return nil, errors.New("-module is only supported on Linux, use -proc instead")
+		case o.modulesPath != defaultModulesPath:
+			return nil, errors.New("-modules-path is only supported on Linux, use -proc instead")
+		}
+	}
+
+	if o.ownProcsOnly && !focus.ProcFSSupported {
+		slog.Warn("-own-procs-only is only supported on Linux, matching every user's processes")
+	}
+
+	if o.jitter < 0 || o.jitter >= 100 {
+		return nil, fmt.Errorf("jitter must be at least 0 and less than 100 percent, got %g", o.jitter)
+	}
+
+	for _, ctrl := range o.controls {
+		if name, _, ok := strings.Cut(ctrl, "="); !ok || name == "" {
+			return nil, fmt.Errorf("invalid control %q, expected name=value", ctrl)
+		}
+	}
+	switch o.ctrlMode {
+	case ctrlModeAuto:
+	case ctrlModeNudge:
+		if !o.useNative {
+			return nil, errors.New("-ctrl-mode nudge sets the control natively, set -native as well")
+		}
+	default:
+		return nil, fmt.Errorf("invalid control mode %q, must be %s or %s", o.ctrlMode, ctrlModeAuto, ctrlModeNudge)
+	}
+
+	if len(o.controls) > 0 && len(o.command) > 0 {
+		return nil, errors.New("-ctrl builds the v4l2-ctl command, it can't be used with a refocus command")
+	}
+
+	runner, err := o.runner()
+	if err != nil {
+		return nil, err
+	}
+
+	// -cmd-file holds what would otherwise be the arguments or -cmd
+	command, script := o.command, o.shellCommand
+	if o.cmdFile != "" {
+		if len(o.command) > 0 || o.shellCommand != "" || len(o.controls) > 0 || o.useV4l2 {
+			return nil, errors.New("-cmd-file holds the refocus command, it can't be used with a refocus command, -cmd, -v4l2 or -ctrl")
+		}
+		contents, err := readCommandFile(o.cmdFile)
+		if err != nil {
+			return nil, err
+		}
+		if o.shell {
+			script = contents
+		} else {
+			command = commandLines(contents)
+		}
+	}
+
+	switch {
+	case o.shell && script == "":
+		return nil, errors.New("-shell requires the command to run as -cmd or -cmd-file")
+	case !o.shell && o.shellCommand != "":
+		return nil, errors.New("-cmd is run by the shell, set -shell as well")
+	case o.shell && (len(o.command) > 0 || len(o.controls) > 0 || o.useV4l2):
+		return nil, errors.New("-shell runs -cmd, it can't be used with a refocus command, -v4l2 or -ctrl")
+	}
+
+	// The default v4l2-ctl command tries each autofocus control name until
+	// one works, -ctrl gives the exact controls
+	var (
+		refocusCommand []string
+		controller     focus.CameraController
+	)
+	// A -shell script or given command comes first, -native only falls back
+	// to v4l2-ctl when there is neither
+	switch {
+	case len(o.controls) > 0:
+		refocusCommand = focus.V4L2CtlCommand(o.device, o.controls...)
+	case o.shell:
+		refocusCommand = shellCommand(script)
+	case o.useV4l2 || (o.useNative && len(command) == 0):
+		refocusCommand = focus.V4L2CtlCommand(o.device, "focus_automatic_continuous=1")
+		controller = &focus.V4L2CtlController{Device: o.device, Runner: runner}
+	default:
+		refocusCommand = command
+	}
+
+	if len(refocusCommand) == 0 {
+		return nil, errNoCommand
+	}
+	refocusCommand, err = o.expandCommand(refocusCommand)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := exec.LookPath(refocusCommand[0]); err != nil {
+		if !o.useNative {
+			return nil, fmt.Errorf("refocus command %q not found: %w", refocusCommand[0], err)
+		}
+		slog.Warn("Fallback refocus command not found", "command", refocusCommand[0], "err", err)
+	}
+
+	// Each -fallback-cmd is tried after the refocus command until one works
+	if len(o.fallbackCommands) > 0 {
+		primary := controller
+		if primary == nil {
+			primary = &focus.CommandController{Command: refocusCommand, Runner: runner}
+		}
+		candidates := []focus.CameraController{primary}
+		for _, command := range o.fallbackCommands {
+			argv, err := o.expandCommand(shellCommand(command))
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, &focus.CommandController{Command: argv, Runner: runner})
+		}
+		controller = &focus.CandidateController{Candidates: candidates}
+	}
+
+	// Elsewhere there are no video device nodes, the device is only passed
+	// to the refocus command
+	if focus.ProcFSSupported {
+		if err := focus.CheckDevice(o.device); err != nil {
+			if o.useV4l2 || len(o.controls) > 0 || o.useNative {
+				return nil, err
+			}
+			slog.Warn(err.Error(), "device", o.device)
+		}
+	}
+
+	settings := focus.Options{
+		Name:                   o.name,
+		Device:                 o.device,
+		Detect:                 o.detectModes,
+		MatchMode:              o.matchMode,
+		DetectTimeout:          o.detectTimeout,
+		Processes:              o.processNames,
+		Pid:                    o.pid,
+		ProcMatch:              o.procMatchMode,
+		ProcMatchCmdline:       o.procMatchCmdline,
+		OwnProcessesOnly:       o.ownProcsOnly,
+		Modules:                splitList(o.moduleName),
+		Command:                refocusCommand,
+		Controller:             controller,
+		CheckInterval:          o.checkInterval.d,
+		ProcInterval:           o.procInterval,
+		ModuleInterval:         o.moduleInterval,
+		RefocusInterval:        o.refocusEvery.d,
+		BatteryRefocusInterval: o.batteryRefocus,
+		CmdTimeout:             o.cmdTimeout,
+		MaxBackoff:             o.maxBackoff,
+		OnError:                o.onError,
+		StaleAfter:             o.staleAfter,
+		Cooldown:               o.cooldown,
+		Jitter:                 o.jitter / 100,
+		Warmup:                 o.warmup,
+		InitialDelay:           o.initialDelay,
+		Burst:                  o.burst,
+		BurstGap:               o.burstGap,
+		MaxFailures:            o.maxFailures,
+		FailurePolicy:          o.failurePolicy,
+		AlertCommand:           shellCommand(o.alertCommand),
+		PreHook:                shellCommand(o.preHook),
+		PostHook:               shellCommand(o.postHook),
+		HookStrict:             o.hookStrict,
+		OnStart:                shellCommand(o.onStart),
+		OnStop:                 shellCommand(o.onStop),
+		DryRun:                 o.dryRun,
+		Always:                 o.always,
+		Uevents:                o.uevents,
+		Runner:                 runner,
+	}
+	if o.modulesPath != defaultModulesPath {
+		settings.ModuleChecker = focus.ModulesFile{Path: o.modulesPath}
+	}
+	if o.schedule != "" {
+		schedule, err := focus.ParseSchedule(o.schedule)
+		if err != nil {
+			return nil, err
+		}
+		settings.Schedule = schedule
+	}
+	if o.skipWhenLocked {
+		if lock := newScreenLock(); lock != nil {
+			settings.Inhibitors = append(settings.Inhibitors, lock)
+		}
+	}
+	if o.skipWhenIdle > 0 {
+		if idle := newScreenIdle(o.skipWhenIdle); idle != nil {
+			settings.Inhibitors = append(settings.Inhibitors, idle)
+		}
+	}
+	if o.notify {
+		settings.Notifier = newDesktopNotifier()
+	}
+	if o.useNative {
+		if controller == nil {
+			controller = &focus.CommandController{Command: refocusCommand, Runner: runner}
+		}
+		var primary focus.CameraController = &focus.V4L2Controller{Device: o.device, Control: focus.CIDFocusAuto, Value: 1, Force: o.forceSet}
+		if o.ctrlMode == ctrlModeNudge {
+			primary = &focus.NudgeController{Device: o.device}
+		}
+		settings.Controller = &focus.FallbackController{
+			Primary:  primary,
+			Fallback: controller,
+		}
+	}
+	watcher, err := focus.NewWatcher(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.refocusEvery.d <= 0 {
+		return nil, fmt.Errorf("refocus interval must be greater than zero, got %s", o.refocusEvery.d.String())
+	}
+	if !once && o.checkInterval.d <= o.refocusEvery.d {
+		return nil, fmt.Errorf("check interval (%s) must be greater than refocus interval (%s)", o.checkInterval.d.String(), o.refocusEvery.d.String())
+	}
+	if !once && o.batteryRefocus != 0 && (o.batteryRefocus < 0 || o.checkInterval.d <= o.batteryRefocus) {
+		return nil, fmt.Errorf("battery refocus interval (%s) must be greater than zero and less than check interval (%s)", o.batteryRefocus.String(), o.checkInterval.d.String())
+	}
+	if !once && o.warmup >= o.checkInterval.d {
+		return nil, fmt.Errorf("warmup (%s) must be less than check interval (%s)", o.warmup.String(), o.checkInterval.d.String())
+	}
+
+	return watcher, nil
+}
+
+// runner returns the runner for the refocus command and hooks, running them
+// in -workdir with the -env variables, as -user and -group, at -nice.
+func (o *options) runner() (focus.CommandRunner, error) {
+	var env []string
+	if len(o.env) > 0 || o.cleanEnv {
+		if !o.cleanEnv {
+			env = os.Environ()
+		}
+		for _, kv := range o.env {
+			if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+				return nil, fmt.Errorf("invalid environment variable %q, expected KEY=VALUE", kv)
+			}
+		}
+		// Later values win, so the -env variables override the current ones
+		env = append(env, o.env...)
+	}
+	if o.workdir != "" {
+		if info, err := os.Stat(o.workdir); err != nil {
+			return nil, fmt.Errorf("working directory: %w", err)
+		} else if !info.IsDir() {
+			return nil, fmt.Errorf("working directory %s is not a directory", o.workdir)
+		}
+	}
+
+	exec := focus.ExecRunner{Dir: o.workdir, Env: env}
+	if o.nice != 0 {
+		if o.nice < -20 || o.nice > 19 {
+			return nil, fmt.Errorf("nice must be from -20 to 19, got %d", o.nice)
+		}
+		var err error
+		if exec.Prefix, err = niceCommand(o.nice); err != nil {
+			return nil, err
+		}
+	}
+	if o.runUser != "" || o.runGroup != "" {
+		var err error
+		if exec.SysProcAttr, err = runAsUser(o.runUser, o.runGroup); err != nil {
+			return nil, err
+		}
+	}
+
+	var runner focus.CommandRunner = exec
+	if wrapRunner != nil {
+		runner = wrapRunner(runner)
+	}
+	return runner, nil
+}
+
+// banner describes what watcher will do, printed at startup.
+func (o *options) banner(watcher *focus.Watcher, once bool) string {
+	startedMsg := strings.Builder{}
+	startedMsg.WriteString("Stay Focus started at " + time.Now().Format(time.RFC1123Z) + ":\n")
+	if o.name != "" {
+		startedMsg.WriteString("\tRule: " + o.name + "\n")
+	}
+	if o.devicePattern != "" {
+		startedMsg.WriteString("\tDevice: " + o.device + " (matching " + o.devicePattern + ")\n")
+	} else {
+		startedMsg.WriteString("\tDevice: " + o.device + "\n")
+	}
+	for _, mode := range watcher.Detect {
+		switch mode {
+		case focus.DetectProc, focus.DetectEvent:
+			if len(watcher.Processes) == 1 {
+				startedMsg.WriteString("\tWatching for process: " + watcher.Processes[0] + "\n")
+			} else {
+				startedMsg.WriteString("\tWatching for processes: " + strings.Join(watcher.Processes, ", ") + "\n")
+			}
+			if watcher.OwnProcessesOnly && focus.ProcFSSupported {
+				startedMsg.WriteString("\tOnly matching processes run by uid " + strconv.Itoa(os.Getuid()) + "\n")
+			}
+		case focus.DetectModule:
+			if len(watcher.Modules) == 1 {
+				startedMsg.WriteString("\tWatching module for use: " + watcher.Modules[0] + "\n")
+			} else {
+				startedMsg.WriteString("\tWatching modules for use: " + strings.Join(watcher.Modules, ", ") + "\n")
+			}
+		case focus.DetectFD, focus.DetectFuser:
+			startedMsg.WriteString("\tWatching for any process with the device open\n")
+		case focus.DetectPid:
+			startedMsg.WriteString("\tWatching for process ID: " + strconv.Itoa(watcher.Pid) + "\n")
+		case focus.DetectAudio:
+			startedMsg.WriteString("\tWatching for any application recording audio\n")
+		}
+	}
+	if len(watcher.Detect) > 1 {
+		startedMsg.WriteString("\tRefocusing when " + watcher.MatchMode + " of the above are in use\n")
+	}
+	if watcher.InitialDelay > 0 && !once {
+		startedMsg.WriteString("\tFirst check after: " + watcher.InitialDelay.String() + "\n")
+	}
+	if watcher.Schedule != nil {
+		startedMsg.WriteString("\tActive during: " + watcher.Schedule.String() + "\n")
+	}
+	if watcher.Always {
+		startedMsg.WriteString("\tAlways on: refocusing whether or not the camera is in use\n")
+	} else if !once {
+		startedMsg.WriteString("\tChecking if in use every: " + watcher.CheckInterval.String() + "\n")
+		if watcher.ProcInterval > 0 && watcher.ProcInterval != watcher.CheckInterval {
+			startedMsg.WriteString("\tLooking for processes every: " + watcher.ProcInterval.String() + "\n")
+		}
+		if watcher.ModuleInterval > 0 && watcher.ModuleInterval != watcher.CheckInterval {
+			startedMsg.WriteString("\tChecking module usage every: " + watcher.ModuleInterval.String() + "\n")
+		}
+	}
+	if o.useNative {
+		native := "native ioctl on " + o.device
+		if o.ctrlMode == ctrlModeNudge {
+			native = "nudging focus_absolute on " + o.device
+		}
+		startedMsg.WriteString("\tRefocus: " + native + ", falling back to: " + strings.Join(watcher.Command, " ") + "\n")
+	} else {
+		startedMsg.WriteString("\tRefocus command: " + strings.Join(watcher.Command, " ") + "\n")
+	}
+	if once {
+		startedMsg.WriteString("\tOne-shot run: will check once, refocus if in use and exit\n")
+	} else {
+		startedMsg.WriteString("\tWill run refocus command every: " + watcher.RefocusInterval.String() + "\n")
+		if watcher.BatteryRefocusInterval > 0 {
+			startedMsg.WriteString("\tOn battery every: " + watcher.BatteryRefocusInterval.String() + "\n")
+		}
+	}
+	if o.dryRun {
+		startedMsg.WriteString("\tDRY RUN: refocus command will only be logged, not run\n")
+	}
+	return startedMsg.String()
+}
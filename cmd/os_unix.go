@@ -0,0 +1,110 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"os/signal"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// shellCommand returns the argv running command with sh, or nil if command is
+// empty.
+func shellCommand(command string) []string {
+	if command == "" {
+		return nil
+	}
+	return []string{"sh", "-c", command}
+}
+
+// niceCommand returns the command prefix running a command with its niceness
+// raised by nice.
+func niceCommand(nice int) ([]string, error) {
+	return []string{"nice", "-n", strconv.Itoa(nice)}, nil
+}
+
+// lockFile takes an exclusive lock on f without blocking. The lock is released
+// when f is closed.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// listenPrivate listens on the Unix socket path, created accessible to this
+// user only. The umask is set while it is created rather than the socket
+// chmodded after, which would leave a moment another user could connect.
+func listenPrivate(path string) (net.Listener, error) {
+	old := syscall.Umask(0o177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
+
+// notifyPause relays SIGUSR1 to pause and SIGUSR2 to resume.
+func notifyPause(pause, resume chan<- os.Signal) {
+	signal.Notify(pause, syscall.SIGUSR1)
+	signal.Notify(resume, syscall.SIGUSR2)
+}
+
+// openSyslog connects to the local syslog daemon, or journald's syslog socket.
+func openSyslog() (syslogWriter, error) {
+	return syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, "stay-focused")
+}
+
+// runAsUser returns the attributes running commands as the named user and
+// group, either of which may be empty or numeric. Without a group the user's
+// primary group is used. Only root can switch users.
+func runAsUser(username, group string) (*syscall.SysProcAttr, error) {
+	if os.Geteuid() != 0 {
+		return nil, errors.New("-user and -group require running as root")
+	}
+
+	// Root's supplementary groups are dropped, replaced by the user's
+	cred := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+	if username != "" {
+		u, err := user.Lookup(username)
+		if _, numErr := strconv.Atoi(username); err != nil && numErr == nil {
+			u, err = user.LookupId(username)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("looking up user %s: %w", username, err)
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: invalid uid %s", username, u.Uid)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: invalid gid %s", username, u.Gid)
+		}
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+		groups, err := u.GroupIds()
+		if err != nil {
+			return nil, fmt.Errorf("looking up groups of user %s: %w", username, err)
+		}
+		for _, group := range groups {
+			if gid, err := strconv.ParseUint(group, 10, 32); err == nil {
+				cred.Groups = append(cred.Groups, uint32(gid))
+			}
+		}
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if _, numErr := strconv.Atoi(group); err != nil && numErr == nil {
+			g, err = user.LookupGroupId(group)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("looking up group %s: %w", group, err)
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: invalid gid %s", group, g.Gid)
+		}
+		cred.Gid = uint32(gid)
+	}
+	return &syscall.SysProcAttr{Credential: cred}, nil
+}
@@ -0,0 +1,48 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// shellCommand returns the argv running command with cmd.exe, or nil if
+// command is empty.
+func shellCommand(command string) []string {
+	if command == "" {
+		return nil
+	}
+	return []string{"cmd", "/C", command}
+}
+
+// niceCommand fails, Windows has no nice.
+func niceCommand(nice int) ([]string, error) {
+	return nil, errors.New("-nice isn't supported on Windows")
+}
+
+// lockFile does nothing, the pid file isn't locked on Windows.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// listenPrivate listens on the Unix socket path. Windows has no umask, the
+// socket gets the permissions of its directory.
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
+
+// notifyPause does nothing, Windows has no SIGUSR1 or SIGUSR2.
+func notifyPause(pause, resume chan<- os.Signal) {}
+
+// openSyslog fails, Windows has no syslog.
+func openSyslog() (syslogWriter, error) {
+	return nil, errors.New("syslog isn't supported on Windows")
+}
+
+// runAsUser fails, commands can't be run as another user on Windows.
+func runAsUser(username, group string) (*syscall.SysProcAttr, error) {
+	return nil, errors.New("-user and -group aren't supported on Windows")
+}
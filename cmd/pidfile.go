@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// writePidfile writes the process ID to path and locks it for as long as the
+// process runs. It fails if another live process holds the lock. The returned
+// function removes the file and releases the lock.
+func writePidfile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening pid file: %w", err)
+	}
+
+	if err := lockFile(f); err != nil {
+		data, _ := os.ReadFile(path)
+		f.Close()
+		if pid := strings.TrimSpace(string(data)); pid != "" {
+			return nil, fmt.Errorf("already running with pid %s, pid file %s is locked", pid, path)
+		}
+		return nil, fmt.Errorf("already running, pid file %s is locked: %w", path, err)
+	}
+
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writing pid file: %w", err)
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writing pid file: %w", err)
+	}
+
+	return func() {
+		// Remove before unlocking so a new instance can't lock the file only
+		// to have it deleted
+		os.Remove(path)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+
+	"stay-focused/focus"
+)
+
+// watcherSet holds the running watchers, which are replaced when the config
+// file is reloaded.
+type watcherSet struct {
+	// metrics is shared by every watcher, if serving metrics
+	metrics *focus.Metrics
+
+	mu       sync.Mutex
+	watchers []*focus.Watcher
+	// rules is set if the watchers come from rules in the config file
+	rules bool
+}
+
+// get returns the running watchers and whether they come from rules.
+func (s *watcherSet) get() ([]*focus.Watcher, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.watchers, s.rules
+}
+
+// set replaces the running watchers, attaching the shared metrics to them.
+func (s *watcherSet) set(watchers []*focus.Watcher, rules bool) {
+	for _, watcher := range watchers {
+		watcher.Metrics = s.metrics
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchers = watchers
+	s.rules = rules
+}
+
+// reload reads the config file again and builds the watchers it describes,
+// also reporting whether they come from rules. It returns nil, logging why, if
+// there is no config file or it isn't valid, so the current watchers keep
+// running.
+func reload() ([]*focus.Watcher, bool) {
+	if configFile == "" {
+		slog.Warn("Received SIGHUP but no config file to reload")
+		return nil, false
+	}
+
+	watchOpts, err := reloadOptions()
+	if err != nil {
+		slog.Error("Error reloading config, keeping current settings", "path", configFile, "err", err)
+		return nil, false
+	}
+	watchers := make([]*focus.Watcher, len(watchOpts))
+	for i, o := range watchOpts {
+		if watchers[i], err = o.watcher(false); err != nil {
+			slog.Error("Error reloading config, keeping current settings", "path", configFile, "err", err)
+			return nil, false
+		}
+		// Already up and running, so no need to wait again
+		watchers[i].InitialDelay = 0
+	}
+
+	logDevices(watchOpts)
+	slog.Info("Reloaded config", "path", configFile, "watchers", len(watchers))
+	return watchers, watchOpts[0].name != ""
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadPicksUpInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stay-focused.yaml")
+	writeConfig := func(check string) {
+		t.Helper()
+		config := "always: true\ncheck: " + check + "\nrefocus: 5s\ncommand: [true]\n"
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	previous, logger := configFile, slog.Default()
+	configFile = path
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer func() {
+		configFile = previous
+		slog.SetDefault(logger)
+	}()
+
+	writeConfig("30s")
+	watchers, _ := reload()
+	if len(watchers) != 1 || watchers[0].CheckInterval != 30*time.Second {
+		t.Fatalf("reload() = %v, want one watcher checking every 30s", watchers)
+	}
+
+	// As on SIGHUP after editing the config file
+	writeConfig("2m")
+	watchers, _ = reload()
+	if len(watchers) != 1 {
+		t.Fatalf("reload() = %v, want one watcher", watchers)
+	}
+	if got := watchers[0].CheckInterval; got != 2*time.Minute {
+		t.Errorf("CheckInterval = %s after reloading, want 2m0s", got)
+	}
+
+	// A broken config keeps the current watchers
+	if err := os.WriteFile(path, []byte("check: soon\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if watchers, _ := reload(); watchers != nil {
+		t.Errorf("reload() of a broken config = %v, want nil", watchers)
+	}
+}
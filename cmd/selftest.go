@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"stay-focused/focus"
+)
+
+// wrapRunner, if set, wraps the runner of every watcher's refocus command and
+// hooks. The check subcommand sets it to record their output.
+var wrapRunner func(focus.CommandRunner) focus.CommandRunner
+
+// commandRun is a command run by outputRunner.
+type commandRun struct {
+	argv   []string
+	output []byte
+	err    error
+}
+
+// outputRunner keeps the output of each command run by the runners it wraps,
+// to report.
+type outputRunner struct {
+	mu   sync.Mutex
+	runs []commandRun
+}
+
+// wrap returns a runner running commands with runner and recording them.
+func (r *outputRunner) wrap(runner focus.CommandRunner) focus.CommandRunner {
+	return recordingRunner{runner: runner, output: r}
+}
+
+type recordingRunner struct {
+	runner focus.CommandRunner
+	output *outputRunner
+}
+
+func (r recordingRunner) Run(ctx context.Context, argv []string) ([]byte, error) {
+	out, err := r.runner.Run(ctx, argv)
+	r.output.mu.Lock()
+	r.output.runs = append(r.output.runs, commandRun{argv: argv, output: out, err: err})
+	r.output.mu.Unlock()
+	return out, err
+}
+
+// take returns the commands run since it was last called.
+func (r *outputRunner) take() []commandRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runs := r.runs
+	r.runs = nil
+	return runs
+}
+
+// selfTest checks whether each watcher's camera is in use and refocuses it
+// once whether or not it is, printing the commands run with their output and
+// a PASS or FAIL line for each. It reports whether every refocus worked.
+func selfTest(w io.Writer, watchOpts []*options, watchers []*focus.Watcher, runner *outputRunner) bool {
+	passed := true
+	for i, watcher := range watchers {
+		if watchOpts[i].name != "" {
+			fmt.Fprintf(w, "Rule %s:\n", watchOpts[i].name)
+		}
+		fmt.Fprintf(w, "\tDevice: %s\n", watcher.Device)
+
+		if watcher.InUse() {
+			fmt.Fprintf(w, "\tDetection: in use (%s)\n", watcher.Matched())
+		} else {
+			fmt.Fprintf(w, "\tDetection: not in use (%s)\n", strings.Join(watcher.Detect, ", "))
+		}
+
+		fmt.Fprintf(w, "\tRefocusing with: %v\n", watcher.Controller)
+		err := watcher.Refocus()
+		for _, run := range runner.take() {
+			status := "ok"
+			if run.err != nil {
+				status = run.err.Error()
+			}
+			fmt.Fprintf(w, "\tRan: %s (%s)\n", strings.Join(run.argv, " "), status)
+			if out := strings.TrimSpace(string(run.output)); out != "" {
+				fmt.Fprintf(w, "\t\t%s\n", strings.ReplaceAll(out, "\n", "\n\t\t"))
+			}
+		}
+
+		if err != nil {
+			passed = false
+			fmt.Fprintf(w, "FAIL: %s\n", err.Error())
+		} else {
+			fmt.Fprintln(w, "PASS")
+		}
+	}
+	return passed
+}
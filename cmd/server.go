@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"stay-focused/focus"
+)
+
+// serverShutdownTimeout bounds how long to wait for open HTTP requests when
+// shutting down.
+const serverShutdownTimeout = 5 * time.Second
+
+// serveHTTP listens on addr and serves handler until ctx is cancelled. The
+// listener is opened before returning so a bad address is reported at
+// startup. The returned channel is closed once the server has shut down.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) (<-chan struct{}, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	done := make(chan struct{})
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP server failed", "addr", addr, "err", err)
+		}
+	}()
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Serving HTTP", "addr", ln.Addr().String())
+	return done, nil
+}
+
+// statusHandler serves the status of the running watchers as JSON, as a list
+// if they come from rules or else the status of the only watcher.
+func statusHandler(running *watcherSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		watchers, asList := running.get()
+		statuses := make([]focus.Status, len(watchers))
+		for i, watcher := range watchers {
+			statuses[i] = watcher.Status()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		if asList {
+			enc.Encode(statuses)
+		} else {
+			enc.Encode(statuses[0])
+		}
+	}
+}
+
+// healthHandler returns 503 if any running watcher's last maxFailures refocus attempts
+// all failed, otherwise 200.
+func healthHandler(running *watcherSet, maxFailures int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		watchers, _ := running.get()
+		for _, watcher := range watchers {
+			if status := watcher.Status(); maxFailures > 0 && status.ConsecutiveFailures >= maxFailures {
+				http.Error(w, fmt.Sprintf("last %d refocus attempts failed: %s", status.ConsecutiveFailures, status.LastError), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSIGCHLDIgnored(t *testing.T) {
+	stop, hup, pause, resume := notifySignals()
+	defer func() {
+		for _, c := range []chan os.Signal{stop, hup, pause, resume} {
+			signal.Stop(c)
+		}
+	}()
+
+	// As when a refocus command exits
+	if err := syscall.Kill(os.Getpid(), syscall.SIGCHLD); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case s := <-stop:
+		t.Errorf("SIGCHLD relayed as %s to stop", s)
+	case s := <-hup:
+		t.Errorf("SIGCHLD relayed as %s to reload", s)
+	case s := <-pause:
+		t.Errorf("SIGCHLD relayed as %s to pause", s)
+	case s := <-resume:
+		t.Errorf("SIGCHLD relayed as %s to resume", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-hup:
+	case <-time.After(3 * time.Second):
+		t.Error("SIGHUP not relayed to reload")
+	}
+}
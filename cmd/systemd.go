@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// generateSystemd returns a systemd service unit running this executable with
+// the flags set on the command line or environment and the refocus command.
+// The unit is bound to the device unit of each camera watched so it starts
+// when the camera appears and stops when it is removed.
+func generateSystemd(watchOpts []*options) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("finding executable path: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", fmt.Errorf("finding executable path: %w", err)
+	}
+
+	args := []string{systemdQuote(exe)}
+	flag.Visit(func(f *flag.Flag) {
+		if cmdlineFlags[f.Name] {
+			args = append(args, systemdQuote("-"+f.Name+"="+f.Value.String()))
+		}
+	})
+	if len(flag.Args()) > 0 {
+		args = append(args, "--")
+		for _, arg := range flag.Args() {
+			args = append(args, systemdQuote(arg))
+		}
+	}
+
+	var devices []string
+	seen := map[string]bool{}
+	for _, o := range watchOpts {
+		if unit := systemdDeviceUnit(o.device); !seen[unit] {
+			seen[unit] = true
+			devices = append(devices, unit)
+		}
+	}
+
+	unit := strings.Builder{}
+	unit.WriteString("[Unit]\n")
+	unit.WriteString("Description=Stay Focused - Keep your camera focused\n")
+	for _, device := range devices {
+		unit.WriteString("BindsTo=" + device + "\n")
+		unit.WriteString("After=" + device + "\n")
+	}
+	unit.WriteString("\n[Service]\n")
+	unit.WriteString("Type=notify\n")
+	unit.WriteString("WatchdogSec=30\n")
+	unit.WriteString("Restart=always\n")
+	unit.WriteString("RestartSec=1\n")
+	unit.WriteString("ExecStart=" + strings.Join(args, " ") + "\n")
+	unit.WriteString("ExecReload=/bin/kill -HUP $MAINPID\n")
+	unit.WriteString("\n[Install]\n")
+	unit.WriteString("WantedBy=" + strings.Join(devices, " ") + "\n")
+	return unit.String(), nil
+}
+
+// systemdDeviceUnit returns the name of the device unit systemd creates for
+// path, escaped like systemd-escape --path, ex: dev-video0.device.
+func systemdDeviceUnit(path string) string {
+	path = strings.Trim(filepath.Clean(path), "/")
+
+	name := strings.Builder{}
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c == '/':
+			name.WriteByte('-')
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == ':', c == '_', c == '.' && i > 0:
+			name.WriteByte(c)
+		default:
+			fmt.Fprintf(&name, `\x%02x`, c)
+		}
+	}
+	return name.String() + ".device"
+}
+
+// systemdQuote quotes arg for an Exec line if needed, escaping the characters
+// systemd would otherwise expand.
+func systemdQuote(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
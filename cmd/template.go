@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// commandVars are the values available to templates in the refocus command,
+// ex: {{.Device}}.
+type commandVars struct {
+	// Device is the camera device, ex: /dev/video0.
+	Device string
+	// Proc is the comma separated list of processes watched.
+	Proc string
+	// Module is the comma separated list of modules watched.
+	Module string
+}
+
+// expandCommand runs each argument of the refocus command through
+// text/template with the rule's device, processes and modules, so one command
+// can be shared by rules watching different cameras.
+func (o *options) expandCommand(argv []string) ([]string, error) {
+	vars := commandVars{
+		Device: o.device,
+		Proc:   strings.Join(o.processNames, ","),
+		Module: o.moduleName,
+	}
+
+	expanded := make([]string, len(argv))
+	for i, arg := range argv {
+		if !strings.Contains(arg, "{{") {
+			expanded[i] = arg
+			continue
+		}
+		tmpl, err := template.New("command").Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("refocus command argument %q: %w", arg, err)
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, vars); err != nil {
+			return nil, fmt.Errorf("refocus command argument %q: %w", arg, err)
+		}
+		expanded[i] = b.String()
+	}
+	return expanded, nil
+}
@@ -0,0 +1,54 @@
+package focus
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+var (
+	pactlMissing     sync.Once
+	audioUnreachable sync.Once
+)
+
+// isAudioCaptured reports whether any application is recording from a
+// microphone or other audio source, found by running pactl, which works with
+// both PulseAudio and PipeWire. Meetings nearly always use the microphone
+// along with the camera. If pactl isn't installed or there is no audio server
+// a warning is logged once and the audio is reported not in use.
+func (w *Watcher) isAudioCaptured(ctx context.Context) bool {
+	path, err := exec.LookPath("pactl")
+	if err != nil {
+		pactlMissing.Do(func() {
+			w.log.Warn("pactl not found, audio detection disabled")
+		})
+		return false
+	}
+
+	out, err := detectCommand(ctx, path, "list", "short", "source-outputs").CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		audioUnreachable.Do(func() {
+			w.log.Warn("Error listing audio recordings with pactl, is an audio server running?", "output", truncateOutput(out), "err", err)
+		})
+		return false
+	}
+
+	// Each line is a recording stream, starting with its index
+	var streams []string
+	for _, line := range strings.Split(string(bytes.TrimSpace(out)), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			streams = append(streams, fields[0])
+		}
+	}
+	w.log.Debug("Found audio recordings", "streams", streams)
+	if len(streams) == 0 {
+		return false
+	}
+	w.setMatched(DetectAudio, "recording streams "+strings.Join(streams, ", "))
+	return true
+}
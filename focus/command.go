@@ -0,0 +1,72 @@
+package focus
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// maxOutputLen limits how much refocus command output is included in logs.
+const maxOutputLen = 1024
+
+// detectWaitDelay is how long a detection command killed by its context may
+// take to close its output, ex: when a child it started still holds it.
+const detectWaitDelay = 250 * time.Millisecond
+
+// CommandRunner runs a command, returning its combined stdout and stderr.
+// The command should be killed once ctx is done.
+type CommandRunner interface {
+	Run(ctx context.Context, argv []string) ([]byte, error)
+}
+
+// ExecRunner runs commands with os/exec.
+type ExecRunner struct {
+	// Dir is the working directory to run commands in, defaults to the
+	// current directory.
+	Dir string
+	// Env is the environment of the commands as KEY=VALUE pairs, nil uses
+	// the current environment.
+	Env []string
+	// SysProcAttr holds OS specific attributes for the commands, ex: the
+	// user to run them as.
+	SysProcAttr *syscall.SysProcAttr
+	// Prefix is run with each command as its arguments, ex: nice -n 10 to run
+	// them at a lower priority.
+	Prefix []string
+}
+
+func (r ExecRunner) Run(ctx context.Context, argv []string) ([]byte, error) {
+	if len(r.Prefix) > 0 {
+		argv = append(append([]string{}, r.Prefix...), argv...)
+	}
+	var cmd *exec.Cmd
+	if len(argv) >= 2 {
+		cmd = exec.CommandContext(ctx, argv[0], argv[1:]...)
+	} else {
+		cmd = exec.CommandContext(ctx, argv[0])
+	}
+	cmd.Dir = r.Dir
+	cmd.Env = r.Env
+	cmd.SysProcAttr = r.SysProcAttr
+	return cmd.CombinedOutput()
+}
+
+// truncateOutput trims surrounding whitespace from command output and limits
+// it to maxOutputLen bytes so a chatty command can't flood the log.
+func truncateOutput(out []byte) string {
+	out = bytes.TrimSpace(out)
+	if len(out) > maxOutputLen {
+		return string(out[:maxOutputLen]) + "... (truncated)"
+	}
+	return string(out)
+}
+
+// detectCommand returns the command a detection mode runs, killed once ctx is
+// done.
+func detectCommand(ctx context.Context, path string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.WaitDelay = detectWaitDelay
+	return cmd
+}
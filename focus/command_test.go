@@ -0,0 +1,59 @@
+package focus
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// fakeRunner is a CommandRunner that runs nothing, for exercising a Watcher
+// without a camera. It records each command and returns results in turn,
+// repeating the last one, or succeeds with no output if results is empty. It
+// is safe for concurrent use.
+type fakeRunner struct {
+	// results are returned by successive runs
+	results []fakeResult
+
+	mu    sync.Mutex
+	calls [][]string
+	times []time.Time
+}
+
+// fakeResult is what fakeRunner returns for a run.
+type fakeResult struct {
+	output []byte
+	err    error
+}
+
+func (r *fakeRunner) Run(ctx context.Context, argv []string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, append([]string(nil), argv...))
+	r.times = append(r.times, time.Now())
+	if len(r.results) == 0 {
+		return nil, nil
+	}
+	i := len(r.calls) - 1
+	if i >= len(r.results) {
+		i = len(r.results) - 1
+	}
+	return r.results[i].output, r.results[i].err
+}
+
+// Calls returns the commands run so far, in order.
+func (r *fakeRunner) Calls() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]string(nil), r.calls...)
+}
+
+// Times returns when each command was run, in order.
+func (r *fakeRunner) Times() []time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]time.Time(nil), r.times...)
+}
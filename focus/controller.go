@@ -0,0 +1,162 @@
+package focus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// CameraController tells the camera to refocus. Refocus should give up once
+// ctx is done.
+type CameraController interface {
+	Refocus(ctx context.Context) error
+}
+
+// loggingController is implemented by the controllers that log, which the
+// Watcher gives its logger unless their Logger is already set.
+type loggingController interface {
+	setLogger(log *slog.Logger)
+}
+
+// setLogger gives c log if it logs.
+func setLogger(c CameraController, log *slog.Logger) {
+	if c, ok := c.(loggingController); ok {
+		c.setLogger(log)
+	}
+}
+
+// loggerOrDefault returns log, or slog.Default() if it is nil.
+func loggerOrDefault(log *slog.Logger) *slog.Logger {
+	if log == nil {
+		return slog.Default()
+	}
+	return log
+}
+
+// CommandController refocuses by running an external command, such as
+// v4l2-ctl.
+type CommandController struct {
+	// Command is the refocus command and its arguments.
+	Command []string
+	// Runner runs Command, defaults to ExecRunner.
+	Runner CommandRunner
+}
+
+func (c *CommandController) Refocus(ctx context.Context) error {
+	runner := c.Runner
+	if runner == nil {
+		runner = ExecRunner{}
+	}
+
+	out, err := runner.Run(ctx, c.Command)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return &CommandError{Command: c.Command, Output: truncateOutput(out), Err: err}
+}
+
+func (c *CommandController) String() string {
+	return strings.Join(c.Command, " ")
+}
+
+// CandidateController refocuses with the first of Candidates that works,
+// trying each in order until one succeeds. The one that worked is used from
+// then on, until it fails and they are all tried again the next time.
+type CandidateController struct {
+	Candidates []CameraController
+	// Logger receives the controller's logs, the Watcher's logger unless
+	// set, or slog.Default() outside a Watcher.
+	Logger *slog.Logger
+
+	mu     sync.Mutex
+	chosen CameraController
+}
+
+func (c *CandidateController) Refocus(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	log := loggerOrDefault(c.Logger)
+
+	if c.chosen != nil {
+		err := c.chosen.Refocus(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Warn("Refocus failed, will try each command again", "controller", fmt.Sprint(c.chosen), "err", err)
+			c.chosen = nil
+		}
+		return err
+	}
+
+	var err error
+	for _, candidate := range c.Candidates {
+		if err = candidate.Refocus(ctx); err == nil {
+			log.Info("Using refocus command", "controller", fmt.Sprint(candidate))
+			c.chosen = candidate
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Debug("Refocus failed, trying the next command", "controller", fmt.Sprint(candidate), "err", err)
+	}
+	return err
+}
+
+func (c *CandidateController) setLogger(log *slog.Logger) {
+	if c.Logger == nil {
+		c.Logger = log
+	}
+	for _, candidate := range c.Candidates {
+		setLogger(candidate, log)
+	}
+}
+
+func (c *CandidateController) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.chosen != nil {
+		return fmt.Sprint(c.chosen)
+	}
+	names := make([]string, len(c.Candidates))
+	for i, candidate := range c.Candidates {
+		names[i] = fmt.Sprint(candidate)
+	}
+	return strings.Join(names, ", or ")
+}
+
+// CommandError is returned by CommandController when the refocus command
+// fails. Output holds the command's combined stdout and stderr, truncated.
+type CommandError struct {
+	Command []string
+	Output  string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	msg := "refocus command (" + strings.Join(e.Command, " ") + "): " + e.Err.Error()
+	if e.Output != "" {
+		msg += ", output: " + e.Output
+	}
+	return msg
+}
+
+// ExitCode returns the command's exit status, or -1 if it didn't exit
+// normally, for example because it couldn't be started or was killed.
+func (e *CommandError) ExitCode() int {
+	var exitErr *exec.ExitError
+	if errors.As(e.Err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
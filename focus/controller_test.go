@@ -0,0 +1,58 @@
+package focus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestControllerLogsToWatcher(t *testing.T) {
+	var logs bytes.Buffer
+	failing := &CommandController{Command: []string{"v4l2-ctl"}, Runner: &fakeRunner{results: []fakeResult{{err: errors.New("exit status 1")}}}}
+	working := &CommandController{Command: []string{"uvcdynctrl"}, Runner: &fakeRunner{}}
+	candidates := &CandidateController{Candidates: []CameraController{failing, working}}
+	fallback := &FallbackController{Primary: &V4L2CtlController{Device: "/dev/video0"}, Fallback: candidates}
+	w, err := NewWatcher(Options{
+		Name:       "zoom",
+		Controller: fallback,
+		Always:     true,
+		Logger:     slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		logger *slog.Logger
+	}{
+		{"fallback", fallback.Logger},
+		{"candidates", candidates.Logger},
+		{"v4l2-ctl", fallback.Primary.(*V4L2CtlController).Logger},
+	} {
+		if c.logger != w.log {
+			t.Errorf("%s controller logger isn't the watcher's", c.name)
+		}
+	}
+
+	if err := candidates.Refocus(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if line := logs.String(); !strings.Contains(line, "Using refocus command") || !strings.Contains(line, "rule=zoom") {
+		t.Errorf("logs = %q, want the command chosen logged for the rule", line)
+	}
+}
+
+func TestControllerLoggerKept(t *testing.T) {
+	own := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	controller := &NudgeController{Device: "/dev/video0", Logger: own}
+	if _, err := NewWatcher(Options{Controller: controller, Always: true, Logger: discardLogger}); err != nil {
+		t.Fatal(err)
+	}
+	if controller.Logger != own {
+		t.Error("the watcher replaced the controller's own logger")
+	}
+}
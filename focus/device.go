@@ -0,0 +1,140 @@
+package focus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var fuserMissing sync.Once
+
+// ReadLinkFS is a file system that can read symbolic links, which DetectFD
+// needs of Proc to see what each of a process's file descriptors refers to.
+// Its method is the one os.DirFS has from Go 1.25.
+type ReadLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// procDir is os.DirFS for the default Proc, with ReadLink.
+type procDir string
+
+func (d procDir) Open(name string) (fs.File, error) {
+	return os.DirFS(string(d)).Open(name)
+}
+
+func (d procDir) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Readlink(filepath.Join(string(d), name))
+}
+
+// CheckDevice verifies path exists and is a character device, as a camera
+// device node such as /dev/video0 should be.
+func CheckDevice(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("camera device %s not usable: %w", path, err)
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("camera device %s is not a character device", path)
+	}
+	return nil
+}
+
+// ueventMatches reports whether devname, a device added or removed as named in
+// uevents relative to /dev, ex: video0, is Device. A Device that is a symlink,
+// ex: under /dev/v4l/by-id, also matches the device it last resolved to, as
+// the link is gone by the time the device is removed.
+func (w *Watcher) ueventMatches(devname string) bool {
+	if target, err := filepath.EvalSymlinks(w.Device); err == nil {
+		w.deviceTarget = target
+	}
+	path := filepath.Join("/dev", devname)
+	return path == filepath.Clean(w.Device) || path == w.deviceTarget
+}
+
+// isDeviceOpen reports whether any process other than this one holds the
+// device open, found by resolving the <pid>/fd/* symlinks of every process in
+// Proc. Processes whose fds can't be read, usually those owned by other users
+// when not running as root, are skipped.
+func (w *Watcher) isDeviceOpen() bool {
+	target, err := filepath.EvalSymlinks(w.Device)
+	if err != nil {
+		w.log.Error("Error resolving device", "device", w.Device, "err", err)
+		return false
+	}
+	links, ok := w.Proc.(ReadLinkFS)
+	if !ok {
+		w.log.Error("Can't read open devices, Proc doesn't support reading links")
+		return false
+	}
+
+	pids, err := fs.ReadDir(w.Proc, ".")
+	if err != nil {
+		w.log.Error("Error reading /proc", "err", err)
+		return false
+	}
+
+	self := os.Getpid()
+	for _, p := range pids {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil || pid == self {
+			continue
+		}
+
+		fdDir := p.Name() + "/fd"
+		fds, err := fs.ReadDir(w.Proc, fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := links.ReadLink(fdDir + "/" + fd.Name())
+			if err == nil && link == target {
+				w.setMatched(DetectFD, "pid "+p.Name())
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isDeviceInUseFuser reports whether any process holds the device open by
+// running fuser, which writes the pids using the file to stdout and exits 1
+// when there are none. If fuser isn't installed it falls back to isDeviceOpen.
+func (w *Watcher) isDeviceInUseFuser(ctx context.Context) bool {
+	path, err := exec.LookPath("fuser")
+	if err != nil {
+		fuserMissing.Do(func() {
+			w.log.Warn("fuser not found, falling back to scanning /proc for open devices")
+		})
+		return w.isDeviceOpen()
+	}
+
+	out, err := detectCommand(ctx, path, w.Device).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		// A fuser killed by a timed out detection isn't an error of its own
+		if ctx.Err() == nil && (!errors.As(err, &exitErr) || exitErr.ExitCode() != 1) {
+			w.log.Error("Error running fuser", "device", w.Device, "err", err)
+		}
+		return false
+	}
+
+	pids := strings.Fields(string(out))
+	w.log.Debug("Found processes with device open", "device", w.Device, "pids", pids)
+	if len(pids) == 0 {
+		return false
+	}
+	w.setMatched(DetectFuser, "pid "+strings.Join(pids, ", "))
+	return true
+}
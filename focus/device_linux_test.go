@@ -0,0 +1,143 @@
+//go:build linux
+
+package focus
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"testing/fstest"
+)
+
+// linkFS is a ReadLinkFS with its links listed in links.
+type linkFS struct {
+	fstest.MapFS
+	links map[string]string
+}
+
+func (l linkFS) ReadLink(name string) (string, error) {
+	target, ok := l.links[name]
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return target, nil
+}
+
+func TestIsDeviceOpen(t *testing.T) {
+	device := filepath.Join(t.TempDir(), "video0")
+	if err := os.WriteFile(device, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	target, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		links       map[string]string
+		want        bool
+		wantMatched string
+	}{
+		{
+			name:        "open",
+			links:       map[string]string{"20/fd/0": "/dev/null", "21/fd/0": "/dev/pts/0", "21/fd/7": target},
+			want:        true,
+			wantMatched: "fd: pid 21",
+		},
+		{
+			name:  "closed",
+			links: map[string]string{"20/fd/0": "/dev/null", "21/fd/7": target + ".bak"},
+		},
+		{
+			name:  "skips this process",
+			links: map[string]string{strconv.Itoa(os.Getpid()) + "/fd/3": target},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc := linkFS{MapFS: fstest.MapFS{}, links: tt.links}
+			for name := range tt.links {
+				proc.MapFS[name] = &fstest.MapFile{}
+			}
+			w, err := NewWatcher(Options{
+				Device:  device,
+				Detect:  []string{DetectFD},
+				Proc:    proc,
+				Command: []string{"true"},
+				Logger:  discardLogger,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := w.isDeviceOpen(); got != tt.want || w.Matched() != tt.wantMatched {
+				t.Errorf("isDeviceOpen() = %v matching %q, want %v matching %q", got, w.Matched(), tt.want, tt.wantMatched)
+			}
+		})
+	}
+}
+
+func TestIsDeviceOpenProc(t *testing.T) {
+	device := filepath.Join(t.TempDir(), "video0")
+	file, err := os.Create(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	w, err := NewWatcher(Options{Device: device, Detect: []string{DetectFD}, Command: []string{"true"}, Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// This process is skipped, so only a child holding the device counts
+	if w.isDeviceOpen() {
+		t.Fatal("isDeviceOpen() = true before any other process opened the device")
+	}
+	child := exec.Command("sleep", "10")
+	child.ExtraFiles = []*os.File{file}
+	if err := child.Start(); err != nil {
+		t.Skip("can't start a child process:", err)
+	}
+	defer child.Process.Kill()
+	if !w.isDeviceOpen() {
+		t.Error("isDeviceOpen() = false with a child holding the device open")
+	}
+}
+
+func TestDetectFDRequiresReadLink(t *testing.T) {
+	// Only the fs.FS methods, without ReadLink
+	proc := struct{ fs.FS }{fstest.MapFS{}}
+	_, err := NewWatcher(Options{Detect: []string{DetectFD}, Proc: proc, Command: []string{"true"}, Logger: discardLogger})
+	if err == nil {
+		t.Error("NewWatcher() with a Proc that can't read links succeeded")
+	}
+}
+
+func TestUeventMatches(t *testing.T) {
+	w := &Watcher{Options: Options{Device: "/dev/video2"}}
+	for devname, want := range map[string]bool{"video2": true, "video0": false, "video20": false} {
+		if got := w.ueventMatches(devname); got != want {
+			t.Errorf("ueventMatches(%q) with device %s = %v, want %v", devname, w.Device, got, want)
+		}
+	}
+
+	// A link to the device, its uevents naming the device linked to
+	link := filepath.Join(t.TempDir(), "usb-camera-video-index0")
+	if err := os.Symlink("/dev/null", link); err != nil {
+		t.Fatal(err)
+	}
+	w = &Watcher{Options: Options{Device: link}}
+	if !w.ueventMatches("null") || w.ueventMatches("video0") {
+		t.Errorf("ueventMatches() didn't match only the device %s links to", link)
+	}
+	// Removing the device removes the link before the event arrives
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if !w.ueventMatches("null") {
+		t.Error("ueventMatches() of the removed device the link pointed to = false")
+	}
+}
@@ -0,0 +1,26 @@
+package focus
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckDevice(t *testing.T) {
+	regular := filepath.Join(t.TempDir(), "video0")
+	if err := os.WriteFile(regular, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckDevice(regular); err == nil || !strings.Contains(err.Error(), "not a character device") {
+		t.Errorf("CheckDevice() of a regular file = %v, want not a character device", err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "video9")
+	err := CheckDevice(missing)
+	if !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), missing) {
+		t.Errorf("CheckDevice() of a missing device = %v, want it naming the device and not existing", err)
+	}
+}
@@ -0,0 +1,113 @@
+package focus
+
+import (
+	"context"
+	"strings"
+)
+
+// Notifier shows a notification to the user, ex: on the desktop. Notify should
+// not block for long.
+type Notifier interface {
+	Notify(summary, body string)
+}
+
+// callbackQueue is how many Callbacks may wait for a slow one before more
+// are dropped.
+const callbackQueue = 64
+
+// Callbacks are called when a watcher's state changes, for applications
+// embedding it, ex: to update a tray icon. Any may be nil. While Run runs they
+// are called in order from a goroutine of their own, so a slow callback only
+// delays the ones after it and never checking or refocusing. Up to
+// callbackQueue calls wait behind it, then further ones are dropped with a
+// warning. Without Run, ex: calling Refocus directly, they are called right
+// away.
+type Callbacks struct {
+	// OnStart is called when the camera starts being used, with what the
+	// detection modes matched, ex: "proc: zoom".
+	OnStart func(matched string)
+	// OnStop is called when refocusing stops, including when paused or
+	// shutting down while in use.
+	OnStop func()
+	// OnRefocus is called after each successful refocus.
+	OnRefocus func()
+	// OnError is called after each failed refocus with the error.
+	OnError func(err error)
+}
+
+// startCallbacks starts delivering Callbacks from their own goroutine,
+// returning the function stopping it. Calls still queued are made first.
+func (w *Watcher) startCallbacks() func() {
+	c := w.Callbacks
+	if c.OnStart == nil && c.OnStop == nil && c.OnRefocus == nil && c.OnError == nil {
+		return func() {}
+	}
+	queue := make(chan func(), callbackQueue)
+	stop := make(chan struct{})
+	w.callbacks = queue
+	go func() {
+		for {
+			select {
+			case f := <-queue:
+				f()
+			case <-stop:
+				for {
+					select {
+					case f := <-queue:
+						f()
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// callback queues f for the callbacks goroutine, or calls it right away
+// without Run.
+func (w *Watcher) callback(f func()) {
+	if w.callbacks == nil {
+		f()
+		return
+	}
+	select {
+	case w.callbacks <- f:
+	default:
+		w.log.Warn("Callbacks are falling behind, dropping one", "queued", callbackQueue)
+	}
+}
+
+func (w *Watcher) notify(summary, body string) {
+	if w.Notifier == nil {
+		return
+	}
+	if w.Name != "" {
+		summary += " (" + w.Name + ")"
+	}
+	w.Notifier.Notify(summary, body)
+}
+
+// runHook runs a hook command with Runner, given CmdTimeout to finish.
+// Failures are logged and returned, it is up to the caller whether they
+// matter.
+func (w *Watcher) runHook(name string, argv []string) error {
+	if len(argv) == 0 {
+		return nil
+	}
+	if w.DryRun {
+		w.log.Info("Dry run, would run hook", "hook", name, "command", strings.Join(argv, " "))
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.CmdTimeout)
+	defer cancel()
+
+	w.log.Debug("Running hook", "hook", name, "command", strings.Join(argv, " "))
+	out, err := w.Runner.Run(ctx, argv)
+	if err != nil {
+		w.log.Error("Error running hook", "hook", name, "command", strings.Join(argv, " "), "output", truncateOutput(out), "err", err)
+	}
+	return err
+}
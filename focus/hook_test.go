@@ -0,0 +1,54 @@
+package focus
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHooksRunOnTransitions(t *testing.T) {
+	runner := &fakeRunner{}
+	lister := &fakeLister{}
+	w, err := NewWatcher(Options{
+		Processes:       []string{"zoom"},
+		Lister:          lister,
+		Command:         []string{"refocus"},
+		OnStart:         []string{"sh", "-c", "on-start"},
+		OnStop:          []string{"sh", "-c", "on-stop"},
+		Runner:          runner,
+		CheckInterval:   time.Hour,
+		RefocusInterval: 30 * time.Minute,
+		Logger:          discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	defer w.stopRefocus()
+
+	ran := func(hook []string) int {
+		n := 0
+		for _, call := range runner.Calls() {
+			if slices.Equal(call, hook) {
+				n++
+			}
+		}
+		return n
+	}
+	lister.set("zoom")
+	for i := 0; i < 3; i++ {
+		w.check(ctx)
+	}
+	if starts, stops := ran(w.OnStart), ran(w.OnStop); starts != 1 || stops != 0 {
+		t.Errorf("ran on-start %d and on-stop %d times in 3 in use checks, want 1 and 0", starts, stops)
+	}
+
+	lister.set()
+	for i := 0; i < 3; i++ {
+		w.check(ctx)
+	}
+	if starts, stops := ran(w.OnStart), ran(w.OnStop); starts != 1 || stops != 1 {
+		t.Errorf("ran on-start %d and on-stop %d times after 3 more idle checks, want 1 and 1", starts, stops)
+	}
+}
@@ -0,0 +1,26 @@
+package focus
+
+// Inhibitor reports whether refocusing should be held off, ex: while the
+// screen is locked. Implementations should also implement fmt.Stringer to be
+// named in logs.
+type Inhibitor interface {
+	Inhibited() (bool, error)
+}
+
+// inhibited returns the position in Inhibitors, plus one, of the first
+// inhibitor holding off refocusing, or 0 if none is. Inhibitors are told apart
+// by position as they needn't be comparable. Inhibitors that fail are logged
+// and treated as not inhibiting.
+func (w *Watcher) inhibited() int {
+	for i, inhibitor := range w.Inhibitors {
+		inhibited, err := inhibitor.Inhibited()
+		if err != nil {
+			w.log.Debug("Error checking inhibitor", "inhibitor", inhibitor, "err", err)
+			continue
+		}
+		if inhibited {
+			return i + 1
+		}
+	}
+	return 0
+}
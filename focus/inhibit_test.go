@@ -0,0 +1,45 @@
+package focus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// sliceInhibitor is an Inhibitor that can't be compared, holding a slice like
+// an inhibitor running a command. It is inhibited while its first value is
+// set.
+type sliceInhibitor []bool
+
+func (i sliceInhibitor) Inhibited() (bool, error) { return i[0], nil }
+
+func TestUncomparableInhibitor(t *testing.T) {
+	inhibitor := sliceInhibitor{true}
+	w, err := NewWatcher(Options{
+		Always:          true,
+		Inhibitors:      []Inhibitor{inhibitor},
+		Command:         []string{"refocus"},
+		Runner:          &fakeRunner{},
+		CheckInterval:   time.Hour,
+		RefocusInterval: 30 * time.Minute,
+		Logger:          discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	defer w.stopRefocus()
+
+	// Inhibited for two checks in a row, then no longer
+	for i := 0; i < 2; i++ {
+		w.check(ctx)
+		if w.Status().Monitoring {
+			t.Fatalf("monitoring while inhibited, check %d", i+1)
+		}
+	}
+	inhibitor[0] = false
+	w.check(ctx)
+	if !w.Status().Monitoring {
+		t.Error("not monitoring once no longer inhibited")
+	}
+}
@@ -0,0 +1,186 @@
+package focus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the refocus duration
+// histogram buckets.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics collects refocus statistics from one or more watchers and serves
+// them in the Prometheus text exposition format. Metrics are labelled with the
+// watcher's Name as "rule". It is safe for concurrent use.
+type Metrics struct {
+	mu         sync.Mutex
+	attempts   map[string]uint64
+	failures   map[[2]string]uint64
+	monitoring map[string]bool
+	durations  map[string]*histogram
+	// lastSuccess holds the time of each rule's last successful refocus
+	lastSuccess map[string]time.Time
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewMetrics returns an empty Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		attempts:    map[string]uint64{},
+		failures:    map[[2]string]uint64{},
+		monitoring:  map[string]bool{},
+		durations:   map[string]*histogram{},
+		lastSuccess: map[string]time.Time{},
+	}
+}
+
+// observeRefocus records a refocus attempt taking d that failed with err, if
+// not nil.
+func (m *Metrics) observeRefocus(rule string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.attempts[rule]++
+	if err != nil {
+		m.failures[[2]string{rule, exitStatus(err)}]++
+	} else {
+		m.lastSuccess[rule] = time.Now()
+	}
+
+	h, ok := m.durations[rule]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.durations[rule] = h
+	}
+	secs := d.Seconds()
+	for i, bound := range durationBuckets {
+		if secs <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += secs
+}
+
+func (m *Metrics) setMonitoring(rule string, monitoring bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.monitoring[rule] = monitoring
+}
+
+// exitStatus labels a refocus failure with the command's exit status, or
+// "timeout" or "error" when there isn't one.
+func exitStatus(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) && cmdErr.ExitCode() >= 0 {
+		return strconv.Itoa(cmdErr.ExitCode())
+	}
+	return "error"
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics to out in the Prometheus text format.
+func (m *Metrics) WriteTo(out io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cw := &countingWriter{w: out}
+
+	fmt.Fprintln(cw, "# HELP stay_focused_refocus_attempts_total Refocus attempts.")
+	fmt.Fprintln(cw, "# TYPE stay_focused_refocus_attempts_total counter")
+	for _, rule := range sortedKeys(m.attempts) {
+		fmt.Fprintf(cw, "stay_focused_refocus_attempts_total{rule=%q} %d\n", rule, m.attempts[rule])
+	}
+
+	fmt.Fprintln(cw, "# HELP stay_focused_refocus_failures_total Failed refocus attempts by exit status.")
+	fmt.Fprintln(cw, "# TYPE stay_focused_refocus_failures_total counter")
+	failures := make([][2]string, 0, len(m.failures))
+	for k := range m.failures {
+		failures = append(failures, k)
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i][0] != failures[j][0] {
+			return failures[i][0] < failures[j][0]
+		}
+		return failures[i][1] < failures[j][1]
+	})
+	for _, k := range failures {
+		fmt.Fprintf(cw, "stay_focused_refocus_failures_total{rule=%q,exit_status=%q} %d\n", k[0], k[1], m.failures[k])
+	}
+
+	fmt.Fprintln(cw, "# HELP stay_focused_monitoring Whether the camera is in use and being refocused.")
+	fmt.Fprintln(cw, "# TYPE stay_focused_monitoring gauge")
+	for _, rule := range sortedKeys(m.monitoring) {
+		value := 0
+		if m.monitoring[rule] {
+			value = 1
+		}
+		fmt.Fprintf(cw, "stay_focused_monitoring{rule=%q} %d\n", rule, value)
+	}
+
+	fmt.Fprintln(cw, "# HELP stay_focused_last_success_timestamp_seconds Unix time of the last successful refocus.")
+	fmt.Fprintln(cw, "# TYPE stay_focused_last_success_timestamp_seconds gauge")
+	for _, rule := range sortedKeys(m.lastSuccess) {
+		fmt.Fprintf(cw, "stay_focused_last_success_timestamp_seconds{rule=%q} %d\n", rule, m.lastSuccess[rule].Unix())
+	}
+
+	fmt.Fprintln(cw, "# HELP stay_focused_refocus_duration_seconds Time taken by each refocus attempt.")
+	fmt.Fprintln(cw, "# TYPE stay_focused_refocus_duration_seconds histogram")
+	for _, rule := range sortedKeys(m.durations) {
+		h := m.durations[rule]
+		for i, bound := range durationBuckets {
+			fmt.Fprintf(cw, "stay_focused_refocus_duration_seconds_bucket{rule=%q,le=%q} %d\n", rule, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(cw, "stay_focused_refocus_duration_seconds_bucket{rule=%q,le=\"+Inf\"} %d\n", rule, h.count)
+		fmt.Fprintf(cw, "stay_focused_refocus_duration_seconds_sum{rule=%q} %g\n", rule, h.sum)
+		fmt.Fprintf(cw, "stay_focused_refocus_duration_seconds_count{rule=%q} %d\n", rule, h.count)
+	}
+
+	return cw.n, cw.err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// countingWriter counts the bytes written and keeps the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
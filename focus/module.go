@@ -0,0 +1,252 @@
+package focus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProcFSSupported reports whether the Linux /proc and /dev based detection
+// modes, DetectModule and DetectFD, and the camera device checks are
+// available on this platform.
+const ProcFSSupported = procFSSupported
+
+// ErrModuleNotFound is returned by a ModuleChecker when the module isn't
+// loaded.
+var ErrModuleNotFound = errors.New("module not found")
+
+// ModuleChecker reports whether a kernel module is in use. InUse returns
+// ErrModuleNotFound if the module isn't loaded.
+type ModuleChecker interface {
+	InUse(name string) (bool, error)
+}
+
+// ModuleListChecker is a ModuleChecker that can check several modules with
+// one read of the modules list. The Watcher uses ModulesInUse when its
+// ModuleChecker implements it.
+type ModuleListChecker interface {
+	ModuleChecker
+	// ModulesInUse reports which of names are loaded and whether each is in
+	// use. Names missing from the map aren't loaded.
+	ModulesInUse(names []string) (map[string]bool, error)
+}
+
+// ModulesFile is a ModuleChecker reading the file at Path in the /proc/modules
+// format, ex: the host's modules file bind mounted into a container.
+type ModulesFile struct {
+	Path string
+}
+
+// InUse reports whether the named module is in use, the same way as
+// ProcModules.InUse on Linux.
+func (m ModulesFile) InUse(name string) (bool, error) {
+	return moduleInList(m, name)
+}
+
+// ModulesInUse checks names with one read of the file.
+func (m ModulesFile) ModulesInUse(names []string) (map[string]bool, error) {
+	return refcountsInUse(m.refcounts(names))
+}
+
+func (m ModulesFile) refcounts(names []string) (map[string]int, error) {
+	file, err := os.Open(m.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return moduleRefcounts(file, names)
+}
+
+// moduleCounter is a ModuleListChecker reading a modules list, which gives
+// the usage count of each module for the Watcher to log.
+type moduleCounter interface {
+	ModuleListChecker
+	// refcounts is ModulesInUse with the usage counts, unknownRefcount if
+	// the kernel doesn't count module users
+	refcounts(names []string) (map[string]int, error)
+}
+
+// unknownRefcount is the usage count of a module on kernels built without
+// module unloading, which don't count module users and show "-".
+const unknownRefcount = -1
+
+// moduleInList is ModuleChecker.InUse for a ModuleListChecker.
+func moduleInList(m ModuleListChecker, name string) (bool, error) {
+	loaded, err := m.ModulesInUse([]string{name})
+	if err != nil {
+		return false, err
+	}
+	inUse, ok := loaded[name]
+	if !ok {
+		return false, ErrModuleNotFound
+	}
+	return inUse, nil
+}
+
+// modulesInUse reads a modules list in the /proc/modules format from r in one
+// pass and reports which of names are loaded, mapped to whether their usage
+// count is above zero.
+func modulesInUse(r io.Reader, names []string) (map[string]bool, error) {
+	return refcountsInUse(moduleRefcounts(r, names))
+}
+
+// refcountsInUse maps the usage counts of modules to whether each is in use.
+// A module whose users aren't counted is loaded but can't be told in use.
+func refcountsInUse(refcounts map[string]int, err error) (map[string]bool, error) {
+	if err != nil {
+		return nil, err
+	}
+	loaded := make(map[string]bool, len(refcounts))
+	for name, refcount := range refcounts {
+		loaded[name] = refcount > 0
+	}
+	return loaded, nil
+}
+
+// moduleRefcounts reads a modules list in the /proc/modules format from r in
+// one pass and returns the usage count of those of names that are loaded. A
+// "-" usage count is unknownRefcount. Lines too short to have a usage count
+// are skipped.
+func moduleRefcounts(r io.Reader, names []string) (map[string]int, error) {
+	refcounts := make(map[string]int, len(names))
+	scanner := bufio.NewScanner(r)
+	for len(refcounts) < len(names) && scanner.Scan() {
+		s := strings.Fields(scanner.Text())
+		if len(s) < 3 {
+			continue
+		}
+		name, ok := watchedModule(names, s[0])
+		if !ok {
+			continue
+		}
+		if _, seen := refcounts[name]; seen {
+			continue
+		}
+		if s[2] == "-" {
+			refcounts[name] = unknownRefcount
+			continue
+		}
+		refcount, err := strconv.Atoi(s[2])
+		if err != nil || refcount < 0 {
+			return nil, fmt.Errorf("module %s: unexpected usage count %q in modules", s[0], s[2])
+		}
+		refcounts[name] = refcount
+	}
+	// A read error cut the list short, so the modules may be there after all
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading modules: %w", err)
+	}
+	return refcounts, nil
+}
+
+// watchedModule returns the entry of names matching module, compared case
+// insensitively.
+func watchedModule(names []string, module string) (string, bool) {
+	for _, name := range names {
+		if strings.EqualFold(name, module) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// isModuleInUse reports whether any of the watched modules is in use. The
+// first time none of them is loaded it warns, as the module is likely
+// misconfigured, then only logs at debug until one is found again. Errors
+// reading the modules list are logged the same way, as the default module is
+// watched even where there is no /proc/modules, ex: in some containers, and
+// ok is false as whether the module is in use isn't known.
+func (w *Watcher) isModuleInUse() (inUse, ok bool) {
+	found, inUse, err := w.moduleInUse()
+	if err == nil && w.moduleFailing.Swap(false) {
+		w.log.Info("Module usage readable again", "modules", w.Modules)
+	}
+	switch {
+	case err != nil:
+		if !w.moduleFailing.CompareAndSwap(false, true) {
+			w.log.Debug("Error checking module usage", "modules", w.Modules, "err", err)
+		} else if errors.Is(err, fs.ErrNotExist) {
+			w.log.Error("Modules list not found, module detection can't tell whether the module is in use until it is", "modules", w.Modules, "err", err)
+		} else {
+			w.log.Error("Error checking module usage, can't tell whether the module is in use", "modules", w.Modules, "err", err)
+		}
+		return false, false
+	case !found:
+		if w.moduleMissing.CompareAndSwap(false, true) {
+			w.log.Warn("Module not found, check -module names a loaded module", "modules", w.Modules)
+		} else {
+			w.log.Debug("Module not loaded", "modules", w.Modules)
+		}
+	default:
+		if w.moduleMissing.Swap(false) {
+			w.log.Info("Module found", "modules", w.Modules)
+		}
+		if !inUse {
+			w.log.Debug("Module loaded but not in use", "modules", w.Modules)
+		}
+	}
+	return inUse, true
+}
+
+// moduleInUse checks the watched modules with ModuleChecker, reporting whether
+// any of them is loaded and whether any is in use. A ModuleListChecker checks
+// them all with one read of the modules list, logging the usage counts at
+// debug when it reads one. A module whose users the kernel doesn't count is
+// loaded but not in use.
+func (w *Watcher) moduleInUse() (found, inUse bool, err error) {
+	var loaded map[string]bool
+	switch checker := w.ModuleChecker.(type) {
+	case moduleCounter:
+		refcounts, err := checker.refcounts(w.Modules)
+		if err != nil {
+			return false, false, err
+		}
+		for _, module := range w.Modules {
+			refcount, ok := refcounts[module]
+			switch {
+			case !ok:
+			case refcount == unknownRefcount:
+				w.log.Debug("Module usage count", "module", module, "refcount", "-")
+			default:
+				w.log.Debug("Module usage count", "module", module, "refcount", refcount)
+			}
+		}
+		loaded, _ = refcountsInUse(refcounts, nil)
+	case ModuleListChecker:
+		if loaded, err = checker.ModulesInUse(w.Modules); err != nil {
+			return false, false, err
+		}
+	}
+	if loaded != nil {
+		for _, module := range w.Modules {
+			inUse, ok := loaded[module]
+			if ok && inUse {
+				w.setMatched(DetectModule, module)
+				return true, true, nil
+			}
+			found = found || ok
+		}
+		return found, false, nil
+	}
+
+	for _, module := range w.Modules {
+		inUse, err := w.ModuleChecker.InUse(module)
+		if errors.Is(err, ErrModuleNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, false, err
+		}
+		if inUse {
+			w.setMatched(DetectModule, module)
+			return true, true, nil
+		}
+		found = true
+	}
+	return found, false, nil
+}
@@ -0,0 +1,44 @@
+//go:build linux
+
+package focus
+
+import "io/fs"
+
+const procFSSupported = true
+
+// ProcModules is a ModuleChecker reading the modules file of the /proc
+// filesystem Proc.
+type ProcModules struct {
+	Proc fs.FS
+}
+
+// InUse reports whether the named module has a usage count above zero, the
+// third field of its line in /proc/modules, ex:
+//
+//	uvcvideo 139264 1 - Live 0x0000000000000000
+//
+// Module names are compared case insensitively. On kernels built without
+// module unloading the usage count is "-", as users aren't counted, and the
+// module is reported loaded but not in use. Any other usage count that isn't a
+// number is an error.
+func (m ProcModules) InUse(name string) (bool, error) {
+	return moduleInList(m, name)
+}
+
+// ModulesInUse checks names with one read of /proc/modules.
+func (m ProcModules) ModulesInUse(names []string) (map[string]bool, error) {
+	return refcountsInUse(m.refcounts(names))
+}
+
+func (m ProcModules) refcounts(names []string) (map[string]int, error) {
+	file, err := m.Proc.Open("modules")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return moduleRefcounts(file, names)
+}
+
+func defaultModuleChecker(proc fs.FS) ModuleChecker {
+	return ProcModules{Proc: proc}
+}
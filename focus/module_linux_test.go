@@ -0,0 +1,45 @@
+//go:build linux
+
+package focus
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// recordingFS records the names of the files opened from it.
+type recordingFS struct {
+	fs.FS
+	opened []string
+}
+
+func (r *recordingFS) Open(name string) (fs.File, error) {
+	r.opened = append(r.opened, name)
+	return r.FS.Open(name)
+}
+
+func TestModuleListCheckerReadsOnce(t *testing.T) {
+	proc := &recordingFS{FS: fstest.MapFS{"modules": &fstest.MapFile{Data: []byte(
+		"uvcvideo 139264 0 - Live 0x0000000000000000\n" +
+			"videobuf2_v4l2 36864 1 uvcvideo, Live 0x0000000000000000\n" +
+			"v4l2loopback 49152 0 - Live 0x0000000000000000\n",
+	)}}}
+	w, err := NewWatcher(Options{
+		Modules:       []string{"uvcvideo", "v4l2loopback", "missing"},
+		ModuleChecker: ProcModules{Proc: proc},
+		Command:       []string{"true"},
+		Logger:        discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, inUse, err := w.moduleInUse()
+	if err != nil || !found || inUse {
+		t.Errorf("moduleInUse() = %v, %v, %v, want true, false, nil", found, inUse, err)
+	}
+	if len(proc.opened) != 1 {
+		t.Errorf("modules opened %d times for %d modules, want once", len(proc.opened), len(w.Modules))
+	}
+}
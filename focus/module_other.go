@@ -0,0 +1,22 @@
+//go:build !linux
+
+package focus
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+const procFSSupported = false
+
+// unsupportedModules is the ModuleChecker where there are no kernel modules
+// to check.
+type unsupportedModules struct{}
+
+func (unsupportedModules) InUse(name string) (bool, error) {
+	return false, fmt.Errorf("module detection: %w", errUnsupported)
+}
+
+func defaultModuleChecker(proc fs.FS) ModuleChecker {
+	return unsupportedModules{}
+}
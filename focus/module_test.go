@@ -0,0 +1,250 @@
+package focus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModulesInUse(t *testing.T) {
+	const modules = "uvcvideo 139264 2 - Live 0x0000000000000000\n" +
+		"v4l2loopback 49152 0 - Live 0x0000000000000000\n"
+	loaded, err := modulesInUse(strings.NewReader(modules), []string{"UVCVideo", "v4l2loopback", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"UVCVideo": true, "v4l2loopback": false}
+	if !maps.Equal(loaded, want) {
+		t.Errorf("modulesInUse() = %v, want %v", loaded, want)
+	}
+}
+
+func TestModulesInUseMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules string
+		want    map[string]bool
+		wantErr bool
+	}{
+		{
+			name:    "in use",
+			modules: "uvcvideo 139264 1 - Live 0x0000000000000000\n",
+			want:    map[string]bool{"uvcvideo": true},
+		},
+		{
+			name:    "not in use",
+			modules: "uvcvideo 139264 0 - Live 0x0000000000000000\n",
+			want:    map[string]bool{"uvcvideo": false},
+		},
+		{
+			name:    "short lines skipped",
+			modules: "\nuvcvideo\nuvcvideo 139264\n \nuvcvideo 139264 2 - Live 0x0000000000000000\n",
+			want:    map[string]bool{"uvcvideo": true},
+		},
+		{
+			name:    "extra spaces and tabs",
+			modules: "  uvcvideo   139264\t 3   -   Live 0x0000000000000000  \n",
+			want:    map[string]bool{"uvcvideo": true},
+		},
+		{
+			name:    "only the first line of a module counts",
+			modules: "uvcvideo 139264 0 - Live 0x0\nuvcvideo 139264 1 - Live 0x0\n",
+			want:    map[string]bool{"uvcvideo": false},
+		},
+		{
+			name:    "not loaded",
+			modules: "snd_hda_intel 61440 4 - Live 0x0\nbroken line\n",
+			want:    map[string]bool{},
+		},
+		{
+			name:    "empty",
+			modules: "",
+			want:    map[string]bool{},
+		},
+		{
+			name:    "bad count of another module ignored",
+			modules: "snd_hda_intel 61440 x - Live 0x0\nuvcvideo 139264 1 - Live 0x0\n",
+			want:    map[string]bool{"uvcvideo": true},
+		},
+		{
+			name:    "users not counted",
+			modules: "uvcvideo 139264 - - Live 0x0\n",
+			want:    map[string]bool{"uvcvideo": false},
+		},
+		{
+			name:    "count not a number",
+			modules: "uvcvideo 139264 x - Live 0x0\n",
+			wantErr: true,
+		},
+		{
+			name:    "negative count",
+			modules: "uvcvideo 139264 -1 - Live 0x0\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, err := modulesInUse(strings.NewReader(tt.modules), []string{"uvcvideo"})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("modulesInUse() = %v, want an error", loaded)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(loaded, tt.want) {
+				t.Errorf("modulesInUse() = %v, want %v", loaded, tt.want)
+			}
+		})
+	}
+}
+
+func TestModuleRefcountLogged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "modules")
+	if err := os.WriteFile(path, []byte("uvcvideo 139264 2 - Live 0x0\nv4l2loopback 49152 - - Live 0x0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	w, err := NewWatcher(Options{
+		Modules:       []string{"v4l2loopback", "uvcvideo"},
+		ModuleChecker: ModulesFile{Path: path},
+		Detect:        []string{DetectModule},
+		Command:       []string{"true"},
+		Logger:        slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inUse, ok := w.isModuleInUse(); !inUse || !ok {
+		t.Errorf("isModuleInUse() = %v, %v, want in use", inUse, ok)
+	}
+	for _, want := range []string{"module=uvcvideo refcount=2", "module=v4l2loopback refcount=-"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs = %q, want %s", logs.String(), want)
+		}
+	}
+}
+
+func TestModulesFile(t *testing.T) {
+	modules := ModulesFile{Path: filepath.Join("testdata", "modules")}
+	tests := []struct {
+		module  string
+		want    bool
+		wantErr error
+	}{
+		{module: "uvcvideo", want: true},
+		{module: "v4l2loopback", want: false},
+		{module: "missing", wantErr: ErrModuleNotFound},
+	}
+	for _, tt := range tests {
+		inUse, err := modules.InUse(tt.module)
+		if inUse != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("InUse(%q) = %v, %v, want %v, %v", tt.module, inUse, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if _, err := (ModulesFile{Path: filepath.Join("testdata", "missing")}).InUse("uvcvideo"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("InUse() of a missing file = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestModuleErrorsLoggedOnce(t *testing.T) {
+	var logs bytes.Buffer
+	path := filepath.Join(t.TempDir(), "modules")
+	w, err := NewWatcher(Options{
+		Modules:       []string{"uvcvideo"},
+		ModuleChecker: ModulesFile{Path: path},
+		Detect:        []string{DetectPid},
+		Pid:           1,
+		Command:       []string{"true"},
+		Logger:        slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	countLogs := func(level string) int {
+		n := strings.Count(logs.String(), "level="+level)
+		logs.Reset()
+		return n
+	}
+
+	for i := 0; i < 3; i++ {
+		w.isModuleInUse()
+	}
+	if n := countLogs("ERROR"); n != 1 {
+		t.Errorf("logged %d errors for a missing modules list in 3 checks, want 1", n)
+	}
+
+	if err := os.WriteFile(path, []byte("snd_hda_intel 61440 4 - Live 0x0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		w.isModuleInUse()
+	}
+	if n := countLogs("WARN"); n != 1 {
+		t.Errorf("logged %d warnings for a module not loaded in 3 checks, want 1", n)
+	}
+
+	// Failing again after recovering is logged again
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	w.isModuleInUse()
+	if n := countLogs("ERROR"); n != 1 {
+		t.Errorf("logged %d errors once the modules list went missing again, want 1", n)
+	}
+}
+
+func TestModuleUnreadableKeepsState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "modules")
+	if err := os.WriteFile(path, []byte("uvcvideo 139264 1 - Live 0x0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var stops int
+	w, err := NewWatcher(Options{
+		Modules:         []string{"uvcvideo"},
+		ModuleChecker:   ModulesFile{Path: path},
+		Detect:          []string{DetectModule},
+		Command:         []string{"refocus"},
+		Runner:          &fakeRunner{},
+		CheckInterval:   time.Hour,
+		RefocusInterval: 30 * time.Minute,
+		Logger:          discardLogger,
+		Callbacks:       Callbacks{OnStop: func() { stops++ }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	defer w.stopRefocus()
+
+	w.check(ctx)
+	if !w.Status().Monitoring {
+		t.Fatal("not monitoring with the module in use")
+	}
+	if inUse, ok := w.inUseContext(ctx); !inUse || !ok {
+		t.Fatalf("inUseContext() = %v, %v, want in use", inUse, ok)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.inUseContext(ctx); ok {
+		t.Error("inUseContext() knows whether the module is in use with no modules list")
+	}
+	w.check(ctx)
+	if !w.Status().Monitoring || stops != 0 {
+		t.Errorf("monitoring %v with %d stops once the modules list is unreadable, want carrying on", w.Status().Monitoring, stops)
+	}
+}
@@ -0,0 +1,111 @@
+package focus
+
+import (
+	"strings"
+	"time"
+)
+
+// polledResult is the last result of a detection mode with its own interval,
+// see ProcInterval and ModuleInterval.
+type polledResult struct {
+	inUse bool
+	// matched is what the mode added to the watcher's matched description
+	// and pid the matched process, restored when the result is reused
+	matched string
+	pid     int
+	at      time.Time
+}
+
+// modeInterval returns the interval mode is polled at, or 0 if it is checked
+// every CheckInterval. The proc and event modes share one scan of the process
+// list, polled as DetectProc.
+func (w *Watcher) modeInterval(mode string) time.Duration {
+	var interval time.Duration
+	switch mode {
+	case DetectProc, DetectEvent:
+		interval = w.ProcInterval
+	case DetectModule:
+		interval = w.ModuleInterval
+	}
+	if interval == w.CheckInterval {
+		return 0
+	}
+	return interval
+}
+
+// polledMode runs detect for mode, or reuses its last result if mode has an
+// interval that hasn't elapsed since. Half a CheckInterval of slack keeps a
+// result from being reused a whole check too long, and one whose matched
+// process has exited isn't reused. ok is false when detect
+// can't tell whether the camera is in use, which isn't kept for reuse.
+func (w *Watcher) polledMode(mode string, detect func() (inUse, ok bool)) (inUse, ok bool) {
+	interval := w.modeInterval(mode)
+	if interval <= 0 {
+		return detect()
+	}
+	// A result found in use by a process that has since exited is dropped,
+	// or the refocus loop would keep stopping on it until the interval is up
+	if r, ok := w.polled[mode]; ok && r.inUse && r.pid != 0 && procFSSupported && !pidRunning(w.Proc, r.pid) {
+		delete(w.polled, mode)
+	}
+	if r, ok := w.polled[mode]; ok && time.Since(r.at)+w.CheckInterval/2 < interval {
+		if r.inUse {
+			if w.matched != "" {
+				w.matched += "; "
+			}
+			w.matched += r.matched
+			w.matchedPid = r.pid
+		}
+		return r.inUse, true
+	}
+
+	before := len(w.matched)
+	inUse, ok = detect()
+	if !ok {
+		return false, false
+	}
+	r := polledResult{inUse: inUse, pid: w.matchedPid, at: time.Now()}
+	if inUse {
+		r.matched = strings.TrimPrefix(w.matched[before:], "; ")
+	}
+	if w.polled == nil {
+		w.polled = map[string]polledResult{}
+	}
+	w.polled[mode] = r
+	return inUse, true
+}
+
+// known adapts a detection mode that always tells whether the camera is in use
+// to polledMode.
+func known(detect func() bool) func() (inUse, ok bool) {
+	return func() (bool, bool) { return detect(), true }
+}
+
+// pollInUse polls mode between checks while the camera isn't in use,
+// reporting whether mode has started finding it in use so it should be
+// checked right away. While the camera is in use the refocus loop owns the match state and
+// the checks run the mode anyway, as its interval is the shorter.
+func (w *Watcher) pollInUse(mode string) bool {
+	// A detection that timed out is still running and owns the match state
+	if w.detecting.Load() || w.paused.Load() || w.inUse {
+		return false
+	}
+	previous := w.polled[mode]
+	matched, matchedPid := w.matched, w.matchedPid
+	w.matched = ""
+	delete(w.polled, mode)
+	var inUse bool
+	switch mode {
+	case DetectProc:
+		inUse, _ = w.polledMode(mode, known(w.isProcessRunning))
+	case DetectModule:
+		inUse, _ = w.polledMode(mode, w.isModuleInUse)
+	}
+	w.matched, w.matchedPid = matched, matchedPid
+
+	if !inUse || previous.inUse {
+		return false
+	}
+	w.log.Debug("Polled detection found the camera in use, checking", "detect", mode)
+	return true
+}
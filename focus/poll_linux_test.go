@@ -0,0 +1,42 @@
+//go:build linux
+
+package focus
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/mitchellh/go-ps"
+)
+
+func TestPolledResultDroppedOnExit(t *testing.T) {
+	proc := fstest.MapFS{"1234/stat": &fstest.MapFile{Data: []byte("1234 (zoom) S 1")}}
+	lister := &countingLister{procs: []ps.Process{fakeProcess{pid: 1234, executable: "zoom"}}}
+	w, err := NewWatcher(Options{
+		Processes:     []string{"zoom"},
+		Lister:        lister,
+		Proc:          proc,
+		Command:       []string{"true"},
+		CheckInterval: time.Second,
+		ProcInterval:  time.Hour,
+		Logger:        discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !w.InUse() || !w.InUse() || lister.reads != 1 {
+		t.Fatalf("zoom found in use with %d reads of the process list, want the result reused", lister.reads)
+	}
+
+	// zoom exits well within the proc interval
+	delete(proc, "1234/stat")
+	lister.procs = nil
+	if w.InUse() {
+		t.Error("InUse() = true after the matched process exited")
+	}
+	if lister.reads != 2 {
+		t.Errorf("process list read %d times, want again once the matched process exited", lister.reads)
+	}
+}
@@ -0,0 +1,77 @@
+package focus
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPolledModeReusesResult(t *testing.T) {
+	lister := &countingLister{}
+	w, err := NewWatcher(Options{
+		Processes:     []string{"zoom"},
+		Lister:        lister,
+		Command:       []string{"true"},
+		CheckInterval: time.Second,
+		ProcInterval:  time.Hour,
+		Logger:        discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lister.procs = syntheticProcesses(10)
+	lister.procs[3] = fakeProcess{pid: os.Getpid(), executable: "zoom"}
+	for i := 0; i < 3; i++ {
+		if !w.InUse() || w.Matched() != "proc: zoom" || w.matchedPid != os.Getpid() {
+			t.Fatalf("InUse() = false or matched %q pid %d, want the reused zoom match", w.Matched(), w.matchedPid)
+		}
+	}
+	if lister.reads != 1 {
+		t.Errorf("process list read %d times within the proc interval, want once", lister.reads)
+	}
+
+	// Once the interval has elapsed the list is read again
+	r := w.polled[DetectProc]
+	r.at = time.Now().Add(-2 * w.ProcInterval)
+	w.polled[DetectProc] = r
+	lister.procs = syntheticProcesses(10)
+	if w.InUse() {
+		t.Error("InUse() = true after zoom exited and the interval elapsed")
+	}
+	if lister.reads != 2 {
+		t.Errorf("process list read %d times, want again after the interval", lister.reads)
+	}
+}
+
+// BenchmarkDetectionInterval compares checks reading the process list every
+// time with a ProcInterval longer than CheckInterval reusing the last result.
+func BenchmarkDetectionInterval(b *testing.B) {
+	for _, bench := range []struct {
+		name         string
+		procInterval time.Duration
+	}{
+		{"EveryCheck", time.Second},
+		{"ProcInterval", time.Hour},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			lister := &countingLister{procs: syntheticProcesses(1000)}
+			w, err := NewWatcher(Options{
+				Processes:     []string{"zoom", "teams"},
+				Lister:        lister,
+				Command:       []string{"true"},
+				CheckInterval: time.Second,
+				ProcInterval:  bench.procInterval,
+				Logger:        discardLogger,
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w.InUse()
+			}
+			b.ReportMetric(float64(lister.reads)/float64(b.N), "reads/op")
+		})
+	}
+}
@@ -0,0 +1,52 @@
+//go:build linux
+
+package focus
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// powerSupplyDir lists the power supplies known to the kernel.
+const powerSupplyDir = "/sys/class/power_supply"
+
+// onBattery reports whether the system is running on battery: it has a mains
+// or USB power supply and none is online, or has none but a battery is
+// discharging. Without any power supply information it reports false.
+func onBattery() (bool, error) {
+	supplies, err := os.ReadDir(powerSupplyDir)
+	if err != nil {
+		return false, err
+	}
+
+	external, online, discharging := false, false, false
+	for _, supply := range supplies {
+		dir := filepath.Join(powerSupplyDir, supply.Name())
+		switch readSysValue(filepath.Join(dir, "type")) {
+		case "Mains", "USB":
+			external = true
+			if readSysValue(filepath.Join(dir, "online")) == "1" {
+				online = true
+			}
+		case "Battery":
+			if readSysValue(filepath.Join(dir, "status")) == "Discharging" {
+				discharging = true
+			}
+		}
+	}
+	if external {
+		return !online, nil
+	}
+	return discharging, nil
+}
+
+// readSysValue returns the trimmed contents of a sysfs attribute, or "" if it
+// can't be read.
+func readSysValue(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package focus
+
+func onBattery() (bool, error) {
+	return false, errUnsupported
+}
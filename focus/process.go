@@ -0,0 +1,294 @@
+package focus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-ps"
+)
+
+// Process match modes deciding how process names are compared to running
+// processes.
+const (
+	ProcMatchExact     = "exact"
+	ProcMatchSubstring = "substring"
+	ProcMatchRegex     = "regex"
+)
+
+// ProcessLister lists the running processes.
+type ProcessLister interface {
+	Processes() ([]ps.Process, error)
+}
+
+// Reading the process list is retried with a doubling delay, as it can fail
+// when a process exits while being read.
+const (
+	processListAttempts = 3
+	processListBackoff  = 50 * time.Millisecond
+)
+
+// psLister lists processes using go-ps.
+type psLister struct{}
+
+func (psLister) Processes() ([]ps.Process, error) {
+	return ps.Processes()
+}
+
+// isProcessRunning reports whether any running process executable matches any
+// of Processes. The process list is read once and every name tested against
+// it in a single pass. With ProcMatchCmdline the full command line is matched
+// instead, falling back to the executable when it can't be read.
+func (w *Watcher) isProcessRunning() bool {
+	procList, err := w.processes()
+	if err != nil {
+		w.log.Error("Error reading process list, can't tell whether the process is running", "attempts", processListAttempts, "err", err)
+		return false
+	}
+
+	for _, v := range procList {
+		if v.Pid() == w.exitedPid {
+			continue
+		}
+		name := trimExecutable(v.Executable())
+		if w.ProcMatchCmdline {
+			if cmdline, err := readCmdline(w.Proc, v.Pid()); err == nil && cmdline != "" {
+				name = cmdline
+			}
+		}
+		// Ownership is only read for the few processes that match
+		if w.procMatches(name) && w.ownProcess(v.Pid()) {
+			w.log.Debug("Matched process", "proc", name, "pid", v.Pid())
+			w.setMatched(DetectProc, name)
+			w.matchedPid = v.Pid()
+			return true
+		}
+	}
+
+	w.log.Debug("No watched process running", "procs", w.Processes)
+	return false
+}
+
+// processes reads the process list with Lister, retrying a couple of times
+// if it fails.
+func (w *Watcher) processes() ([]ps.Process, error) {
+	delay := processListBackoff
+	for attempt := 1; ; attempt++ {
+		procList, err := w.Lister.Processes()
+		if err == nil || attempt == processListAttempts {
+			return procList, err
+		}
+		w.log.Debug("Error reading process list, retrying", "attempt", attempt, "delay", delay.String(), "err", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// stillRunning is a cheap check, made before each refocus, that pid, the
+// process that made the camera count as in use, hasn't exited since. It only
+// applies when the outcome hangs on that process, otherwise it reports true
+// and the next check decides.
+func (w *Watcher) stillRunning(pid int) bool {
+	if pid == 0 || w.paused.Load() {
+		return true
+	}
+	if w.MatchMode != MatchAll {
+		for _, mode := range w.Detect {
+			if mode != DetectProc && mode != DetectEvent && mode != DetectPid {
+				return true
+			}
+		}
+	}
+
+	return pidRunning(w.Proc, pid)
+}
+
+// pidRunning reports whether pid is running according to <pid>/stat in proc.
+// A zombie, which has exited but not been reaped, isn't running. If the state
+// can't be read for another reason the process is assumed to be running.
+func pidRunning(proc fs.FS, pid int) bool {
+	stat, err := fs.ReadFile(proc, strconv.Itoa(pid)+"/stat")
+	if errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	// The state follows the command name in parentheses, Z for a zombie
+	if i := bytes.LastIndexByte(stat, ')'); i >= 0 && i+2 < len(stat) && stat[i+2] == 'Z' {
+		return false
+	}
+	return true
+}
+
+// isPidWatchedRunning reports whether the process Pid is running, read from
+// /proc where available or else looked up with go-ps.
+func (w *Watcher) isPidWatchedRunning() bool {
+	var running bool
+	if procFSSupported {
+		running = pidRunning(w.Proc, w.Pid)
+	} else {
+		p, err := ps.FindProcess(w.Pid)
+		running = err == nil && p != nil
+	}
+	if !running {
+		w.log.Debug("Watched process ID not running", "pid", w.Pid)
+		return false
+	}
+	w.setMatched(DetectPid, strconv.Itoa(w.Pid))
+	w.matchedPid = w.Pid
+	return true
+}
+
+// procEventMatters reports whether a process event could change whether the
+// camera is in use: a matching process starting, or the matched process
+// exiting. The exited process is skipped by the following check as it may not
+// have been reaped yet.
+func (w *Watcher) procEventMatters(event procEvent) bool {
+	// A detection that timed out is still running and owns the match state
+	if w.detecting.Load() {
+		return false
+	}
+	if event.exit {
+		if event.pid != w.matchedPid {
+			return false
+		}
+		w.log.Debug("Matched process exited", "pid", event.pid)
+		w.exitedPid = event.pid
+		return true
+	}
+
+	// Already refocusing, another matching process changes nothing
+	if w.inUse {
+		return false
+	}
+	name, err := readComm(w.Proc, event.pid)
+	if err != nil {
+		return false
+	}
+	if w.ProcMatchCmdline {
+		if cmdline, err := readCmdline(w.Proc, event.pid); err == nil && cmdline != "" {
+			name = cmdline
+		}
+	}
+	if !w.procMatches(name) || !w.ownProcess(event.pid) {
+		return false
+	}
+	w.log.Debug("Matching process started", "proc", name, "pid", event.pid)
+	return true
+}
+
+// ownProcess reports whether pid may be matched under OwnProcessesOnly: it is
+// run by this user, or the filter doesn't apply. A process whose owner can't be
+// read, usually because it has exited, isn't matched.
+func (w *Watcher) ownProcess(pid int) bool {
+	if !w.OwnProcessesOnly || !procFSSupported {
+		return true
+	}
+	uid, err := readUid(w.Proc, pid)
+	return err == nil && uid == os.Getuid()
+}
+
+// readUid returns the real uid of pid, the first field of the Uid line in
+// <pid>/status in proc.
+func readUid(proc fs.FS, pid int) (int, error) {
+	b, err := fs.ReadFile(proc, strconv.Itoa(pid)+"/status")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if rest, ok := strings.CutPrefix(line, "Uid:"); ok {
+			if fields := strings.Fields(rest); len(fields) > 0 {
+				return strconv.Atoi(fields[0])
+			}
+		}
+	}
+	return 0, fmt.Errorf("no Uid in status of process %d", pid)
+}
+
+// readComm returns the executable name of pid from <pid>/comm in proc, the
+// same name go-ps reports.
+func readComm(proc fs.FS, pid int) (string, error) {
+	b, err := fs.ReadFile(proc, strconv.Itoa(pid)+"/comm")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// readCmdline returns the command line of pid from <pid>/cmdline in proc with
+// its NUL separated arguments joined by spaces.
+func readCmdline(proc fs.FS, pid int) (string, error) {
+	b, err := fs.ReadFile(proc, strconv.Itoa(pid)+"/cmdline")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(bytes.ReplaceAll(b, []byte{0}, []byte{' '}))), nil
+}
+
+// newProcMatcher builds a function reporting whether a process name matches
+// any of procs according to mode. Regular expressions are compiled once up
+// front so a bad pattern is reported before monitoring starts.
+func newProcMatcher(mode string, procs []string) (func(name string) bool, error) {
+	switch mode {
+	case ProcMatchExact:
+		// Deduplicated so each name is compared once, with EqualFold so
+		// process names don't have to be lowercased on every check
+		var targets []string
+		seen := make(map[string]bool, len(procs))
+		for _, proc := range procs {
+			if lower := strings.ToLower(trimExecutable(proc)); !seen[lower] {
+				seen[lower] = true
+				targets = append(targets, lower)
+			}
+		}
+		return func(name string) bool {
+			for _, proc := range targets {
+				if strings.EqualFold(name, proc) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case ProcMatchSubstring:
+		lower := make([]string, len(procs))
+		for i, proc := range procs {
+			lower[i] = strings.ToLower(trimExecutable(proc))
+		}
+		return func(name string) bool {
+			// ToLower only allocates for names with upper case letters
+			name = strings.ToLower(name)
+			for _, proc := range lower {
+				if strings.Contains(name, proc) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case ProcMatchRegex:
+		patterns := make([]*regexp.Regexp, len(procs))
+		for i, proc := range procs {
+			re, err := regexp.Compile(proc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid process pattern %q: %w", proc, err)
+			}
+			patterns[i] = re
+		}
+		return func(name string) bool {
+			for _, re := range patterns {
+				if re.MatchString(name) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid process match mode %q, must be one of: %s, %s, %s", mode, ProcMatchExact, ProcMatchSubstring, ProcMatchRegex)
+	}
+}
@@ -0,0 +1,97 @@
+//go:build linux
+
+package focus
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	"github.com/mitchellh/go-ps"
+)
+
+func TestOwnProcessesOnly(t *testing.T) {
+	// Process 10 is someone else's zoom, 11 is ours and 12 is unrelated
+	me, other := os.Getuid(), os.Getuid()+1
+	files := fstest.MapFS{}
+	for pid, uid := range map[int]int{10: other, 11: me, 12: me} {
+		files[strconv.Itoa(pid)+"/status"] = &fstest.MapFile{Data: []byte(fmt.Sprintf("Name:\tx\nUid:\t%d\t%d\t%d\t%d\n", uid, uid, uid, uid))}
+		files[strconv.Itoa(pid)+"/comm"] = &fstest.MapFile{Data: []byte("zoom\n")}
+	}
+	files["12/comm"] = &fstest.MapFile{Data: []byte("bash\n")}
+
+	tests := []struct {
+		name      string
+		procs     []ps.Process
+		want      bool
+		wantReads []string
+	}{
+		{
+			name:      "own process",
+			procs:     []ps.Process{fakeProcess{pid: 12, executable: "bash"}, fakeProcess{pid: 11, executable: "zoom"}},
+			want:      true,
+			wantReads: []string{"11/status"},
+		},
+		{
+			name:      "other user's process",
+			procs:     []ps.Process{fakeProcess{pid: 10, executable: "zoom"}, fakeProcess{pid: 12, executable: "bash"}},
+			want:      false,
+			wantReads: []string{"10/status"},
+		},
+		{
+			name:      "no owner read without a name match",
+			procs:     []ps.Process{fakeProcess{pid: 12, executable: "bash"}},
+			want:      false,
+			wantReads: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc := &recordingFS{FS: files}
+			w, err := NewWatcher(Options{
+				Processes:        []string{"zoom"},
+				OwnProcessesOnly: true,
+				Lister:           &fakeLister{procs: tt.procs},
+				Proc:             proc,
+				Command:          []string{"true"},
+				Logger:           discardLogger,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := w.isProcessRunning(); got != tt.want {
+				t.Errorf("isProcessRunning() = %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(proc.opened, tt.wantReads) {
+				t.Errorf("read %q, want %q", proc.opened, tt.wantReads)
+			}
+		})
+	}
+
+	t.Run("events", func(t *testing.T) {
+		proc := &recordingFS{FS: files}
+		w, err := NewWatcher(Options{
+			Processes:        []string{"zoom"},
+			Detect:           []string{DetectEvent},
+			OwnProcessesOnly: true,
+			Proc:             proc,
+			Command:          []string{"true"},
+			Logger:           discardLogger,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for pid, want := range map[int]bool{10: false, 11: true, 12: false} {
+			proc.opened = nil
+			if got := w.procEventMatters(procEvent{pid: pid}); got != want {
+				t.Errorf("procEventMatters(%d) = %v, want %v", pid, got, want)
+			}
+			if pid == 12 && slices.Contains(proc.opened, "12/status") {
+				t.Error("read the owner of a process that doesn't match")
+			}
+		}
+	})
+}
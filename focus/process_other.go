@@ -0,0 +1,8 @@
+//go:build !windows
+
+package focus
+
+// trimExecutable returns name unchanged, executables have no extension here.
+func trimExecutable(name string) string {
+	return name
+}
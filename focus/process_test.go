@@ -0,0 +1,168 @@
+package focus
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/go-ps"
+)
+
+// countingLister is a ProcessLister counting how often the process list is
+// read.
+type countingLister struct {
+	procs []ps.Process
+	reads int
+}
+
+func (l *countingLister) Processes() ([]ps.Process, error) {
+	l.reads++
+	return l.procs, nil
+}
+
+// syntheticProcesses returns n processes, none of them a watched one, as on a
+// busy machine.
+func syntheticProcesses(n int) []ps.Process {
+	procs := make([]ps.Process, n)
+	for i := range procs {
+		procs[i] = fakeProcess{pid: os.Getpid(), executable: fmt.Sprintf("Worker-%d", i)}
+	}
+	return procs
+}
+
+func TestProcessListReadOncePerCheck(t *testing.T) {
+	lister := &countingLister{procs: syntheticProcesses(100)}
+	w, err := NewWatcher(Options{
+		Processes: []string{"zoom", "teams", "obs", "chrome"},
+		Detect:    []string{DetectProc, DetectEvent},
+		Lister:    lister,
+		Command:   []string{"true"},
+		Logger:    discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for check := 1; check <= 3; check++ {
+		if w.InUse() {
+			t.Fatal("InUse() = true with no watched process running")
+		}
+		if lister.reads != check {
+			t.Errorf("process list read %d times in %d checks, want once per check", lister.reads, check)
+		}
+	}
+}
+
+func TestProcessListRetried(t *testing.T) {
+	lister := &fakeLister{failures: 1}
+	lister.set("bash", "zoom")
+	w, err := NewWatcher(Options{
+		Processes: []string{"zoom"},
+		Lister:    lister,
+		Command:   []string{"true"},
+		Logger:    discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !w.isProcessRunning() {
+		t.Error("isProcessRunning() = false after the process list read failed once")
+	}
+	if lister.reads != 2 {
+		t.Errorf("process list read %d times, want a retry after the failure", lister.reads)
+	}
+	if w.Matched() != "proc: zoom" {
+		t.Errorf("Matched() = %q, want %q", w.Matched(), "proc: zoom")
+	}
+}
+
+// BenchmarkIsProcessRunning checks for several watched processes among 1000
+// running ones, reading the process list once per check.
+func BenchmarkIsProcessRunning(b *testing.B) {
+	lister := &countingLister{procs: syntheticProcesses(1000)}
+	w, err := NewWatcher(Options{
+		Processes: []string{"zoom", "teams", "obs", "chrome"},
+		Lister:    lister,
+		Command:   []string{"true"},
+		Logger:    discardLogger,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w.isProcessRunning()
+	}
+	b.ReportMetric(float64(lister.reads)/float64(b.N), "reads/op")
+}
+
+func TestProcMatcher(t *testing.T) {
+	tests := []struct {
+		mode  string
+		procs []string
+		name  string
+		want  bool
+	}{
+		{ProcMatchExact, []string{"zoom"}, "zoom", true},
+		{ProcMatchExact, []string{"Zoom"}, "ZOOM", true},
+		{ProcMatchExact, []string{"zoom", "zoom"}, "zoom", true},
+		{ProcMatchExact, []string{"zoom"}, "zoom.real", false},
+		{ProcMatchExact, []string{"teams", "zoom"}, "zoom", true},
+		{ProcMatchSubstring, []string{"zoom"}, "ZoomWebviewHost", true},
+		{ProcMatchSubstring, []string{"teams"}, "zoom", false},
+		{ProcMatchRegex, []string{"^zoom(\\.real)?$"}, "zoom.real", true},
+		{ProcMatchRegex, []string{"^zoom$"}, "zoom.real", false},
+	}
+	for _, tt := range tests {
+		matches, err := newProcMatcher(tt.mode, tt.procs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := matches(tt.name); got != tt.want {
+			t.Errorf("%s match of %q against %q = %v, want %v", tt.mode, tt.name, tt.procs, got, tt.want)
+		}
+	}
+
+	if _, err := newProcMatcher(ProcMatchRegex, []string{"("}); err == nil {
+		t.Error("newProcMatcher() of a bad pattern succeeded")
+	}
+}
+
+// BenchmarkProcMatch compares matching a synthetic 1000 process list by
+// lowercasing every executable with the prebuilt lowercase targets compared
+// with EqualFold.
+func BenchmarkProcMatch(b *testing.B) {
+	procs := syntheticProcesses(1000)
+	targets := []string{"zoom", "teams", "obs", "chrome"}
+
+	b.Run("ToLower", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, p := range procs {
+				name := strings.ToLower(p.Executable())
+				for _, target := range targets {
+					if name == strings.ToLower(target) {
+						b.Fatal("matched", name)
+					}
+				}
+			}
+		}
+	})
+	b.Run("EqualFold", func(b *testing.B) {
+		matches, err := newProcMatcher(ProcMatchExact, targets)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, p := range procs {
+				if matches(p.Executable()) {
+					b.Fatal("matched", p.Executable())
+				}
+			}
+		}
+	})
+}
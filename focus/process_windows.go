@@ -0,0 +1,14 @@
+//go:build windows
+
+package focus
+
+import "strings"
+
+// trimExecutable drops the .exe extension so -proc zoom matches Zoom.exe, as
+// go-ps reports executable names with their extension on Windows.
+func trimExecutable(name string) string {
+	if len(name) > 4 && strings.EqualFold(name[len(name)-4:], ".exe") {
+		return name[:len(name)-4]
+	}
+	return name
+}
@@ -0,0 +1,125 @@
+//go:build linux
+
+package focus
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Proc connector constants from linux/connector.h and linux/cn_proc.h.
+const (
+	netlinkConnector   = 11
+	cnIdxProc          = 1
+	cnValProc          = 1
+	procCnMcastListen  = 1
+	procEventExec      = 0x00000002
+	procEventExit      = 0x80000000
+	nlmsgHdrLen        = 16
+	cnMsgLen           = 20
+	procEventHeaderLen = 16
+)
+
+// procEvent is a process starting a new program or exiting.
+type procEvent struct {
+	pid  int
+	exit bool
+}
+
+// listenProcEvents subscribes to the kernel proc connector and sends an event
+// whenever a process execs or exits. This needs CAP_NET_ADMIN. The socket is
+// closed when ctx is cancelled.
+func listenProcEvents(ctx context.Context) (<-chan procEvent, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, netlinkConnector)
+	if err != nil {
+		return nil, fmt.Errorf("opening proc connector socket: %w", err)
+	}
+	// Pid 0 lets the kernel pick the port id, so several watchers in this
+	// process can each have a socket
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: cnIdxProc}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("binding proc connector socket: %w", err)
+	}
+	var portID uint32
+	if sa, err := syscall.Getsockname(fd); err == nil {
+		if nl, ok := sa.(*syscall.SockaddrNetlink); ok {
+			portID = nl.Pid
+		}
+	}
+
+	// Subscribe: a netlink header, wrapping a connector message, wrapping the
+	// listen operation
+	msg := make([]byte, nlmsgHdrLen+cnMsgLen+4)
+	binary.NativeEndian.PutUint32(msg[0:], uint32(len(msg)))
+	binary.NativeEndian.PutUint16(msg[4:], syscall.NLMSG_DONE)
+	binary.NativeEndian.PutUint32(msg[12:], portID)
+	binary.NativeEndian.PutUint32(msg[16:], cnIdxProc)
+	binary.NativeEndian.PutUint32(msg[20:], cnValProc)
+	binary.NativeEndian.PutUint16(msg[32:], 4)
+	binary.NativeEndian.PutUint32(msg[36:], procCnMcastListen)
+	if err := syscall.Sendto(fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("subscribing to proc events: %w", err)
+	}
+
+	// Non-blocking so reads use the runtime poller and Close interrupts them
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("opening proc connector socket: %w", err)
+	}
+	sock := os.NewFile(uintptr(fd), "cn_proc")
+
+	go func() {
+		<-ctx.Done()
+		sock.Close()
+	}()
+
+	events := make(chan procEvent, 64)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := sock.Read(buf)
+			if err != nil {
+				return
+			}
+			event, ok := parseProcEvent(buf[:n])
+			if !ok {
+				continue
+			}
+			// Drop events rather than block when the machine is busy, the
+			// polling check catches up on anything missed
+			select {
+			case events <- event:
+			default:
+			}
+		}
+	}()
+	return events, nil
+}
+
+// parseProcEvent parses the exec and exit events from a proc connector
+// message, ignoring other events and the exit of threads other than the main
+// thread.
+func parseProcEvent(msg []byte) (procEvent, bool) {
+	data := nlmsgHdrLen + cnMsgLen + procEventHeaderLen
+	if len(msg) < data+8 {
+		return procEvent{}, false
+	}
+	what := binary.NativeEndian.Uint32(msg[nlmsgHdrLen+cnMsgLen:])
+	pid := binary.NativeEndian.Uint32(msg[data:])
+	tgid := binary.NativeEndian.Uint32(msg[data+4:])
+
+	switch what {
+	case procEventExec:
+		return procEvent{pid: int(tgid)}, true
+	case procEventExit:
+		if pid != tgid {
+			return procEvent{}, false
+		}
+		return procEvent{pid: int(tgid), exit: true}, true
+	}
+	return procEvent{}, false
+}
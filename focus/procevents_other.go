@@ -0,0 +1,14 @@
+//go:build !linux
+
+package focus
+
+import "context"
+
+type procEvent struct {
+	pid  int
+	exit bool
+}
+
+func listenProcEvents(ctx context.Context) (<-chan procEvent, error) {
+	return nil, errUnsupported
+}
@@ -0,0 +1,150 @@
+package focus
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule is a set of weekly time windows, parsed by ParseSchedule.
+type Schedule struct {
+	spec    string
+	windows []window
+}
+
+// window is a daily time range, in minutes after midnight, on some days of
+// the week. A window ending before it starts runs past midnight into the next
+// day.
+type window struct {
+	days       [7]bool
+	start, end int
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseSchedule parses a schedule of one or more windows separated by
+// semicolons. Each window is an optional comma separated list of days or day
+// ranges followed by a time range, ex: "Mon-Fri 09:00-17:00; Sat 10:00-12:00".
+// Without days the window applies every day. A time range ending before it
+// starts, ex: 22:00-02:00, runs past midnight.
+func ParseSchedule(spec string) (*Schedule, error) {
+	s := &Schedule{spec: spec}
+	for _, part := range strings.Split(spec, ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("invalid schedule window %q, expected days and a time range, ex: Mon-Fri 09:00-17:00", strings.TrimSpace(part))
+		}
+
+		var w window
+		if len(fields) == 1 {
+			w.days = [7]bool{true, true, true, true, true, true, true}
+		} else {
+			var err error
+			if w.days, err = parseDays(fields[0]); err != nil {
+				return nil, err
+			}
+		}
+
+		from, to, ok := strings.Cut(fields[len(fields)-1], "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid schedule time range %q, expected HH:MM-HH:MM", fields[len(fields)-1])
+		}
+		var err error
+		if w.start, err = parseClock(from); err != nil {
+			return nil, err
+		}
+		if w.end, err = parseClock(to); err != nil {
+			return nil, err
+		}
+		s.windows = append(s.windows, w)
+	}
+	if len(s.windows) == 0 {
+		return nil, fmt.Errorf("empty schedule")
+	}
+	return s, nil
+}
+
+// parseDays parses a comma separated list of days and day ranges, ex:
+// Mon-Fri,Sun. A range may wrap around the week, ex: Fri-Mon.
+func parseDays(spec string) ([7]bool, error) {
+	var days [7]bool
+	for _, item := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		first, err := parseDay(from)
+		if err != nil {
+			return days, err
+		}
+		last := first
+		if isRange {
+			if last, err = parseDay(to); err != nil {
+				return days, err
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseDay(name string) (time.Weekday, error) {
+	key := strings.ToLower(name)
+	if len(key) > 3 {
+		key = key[:3]
+	}
+	day, ok := weekdays[key]
+	if !ok {
+		return 0, fmt.Errorf("invalid schedule day %q, expected a day name such as Mon", name)
+	}
+	return day, nil
+}
+
+// parseClock parses HH:MM into minutes after midnight. 24:00 is allowed as
+// the end of the day.
+func parseClock(clock string) (int, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(clock, "%d:%d", &h, &m); err != nil || n != 2 || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid schedule time %q, expected HH:MM", clock)
+	}
+	return h*60 + m, nil
+}
+
+// Active reports whether t falls within one of the schedule's windows, in t's
+// time zone.
+func (s *Schedule) Active(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+	for _, w := range s.windows {
+		if w.start <= w.end {
+			if w.days[today] && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		// Past midnight: the evening of a scheduled day, or the early hours
+		// after one
+		if (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
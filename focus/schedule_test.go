@@ -0,0 +1,64 @@
+package focus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleActive(t *testing.T) {
+	// 2024-01-01 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.January, day, hour, minute, 0, 0, time.Local)
+	}
+	const mon, wed, fri, sat, sun = 1, 3, 5, 6, 7
+
+	tests := []struct {
+		spec string
+		at   time.Time
+		want bool
+	}{
+		{"Mon-Fri 09:00-17:00", at(mon, 9, 0), true},
+		{"Mon-Fri 09:00-17:00", at(mon, 8, 59), false},
+		{"Mon-Fri 09:00-17:00", at(fri, 16, 59), true},
+		{"Mon-Fri 09:00-17:00", at(fri, 17, 0), false},
+		{"Mon-Fri 09:00-17:00", at(sat, 12, 0), false},
+		{"09:00-17:00", at(sun, 12, 0), true},
+		{"Mon-Fri 09:00-17:00; Sat 10:00-12:00", at(sat, 11, 0), true},
+		{"Mon-Fri 09:00-17:00; Sat 10:00-12:00", at(sat, 12, 30), false},
+		{"Fri-Mon 12:00-13:00", at(sun, 12, 30), true},
+		{"Fri-Mon 12:00-13:00", at(wed, 12, 30), false},
+		{"mon,wednesday 00:00-24:00", at(wed, 23, 59), true},
+		// Past midnight belongs to the day the window started
+		{"Fri 22:00-02:00", at(fri, 23, 0), true},
+		{"Fri 22:00-02:00", at(sat, 1, 59), true},
+		{"Fri 22:00-02:00", at(sat, 2, 0), false},
+		{"Fri 22:00-02:00", at(fri, 1, 0), false},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) = %v", tt.spec, err)
+		}
+		if got := s.Active(tt.at); got != tt.want {
+			t.Errorf("%q Active(%s) = %v, want %v", tt.spec, tt.at.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		";",
+		"Mon-Fri",
+		"Mon-Fri 09:00",
+		"Funday 09:00-17:00",
+		"Mon 9-17",
+		"Mon 09:60-17:00",
+		"Mon 09:00-24:01",
+		"Mon Tue 09:00-17:00",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want an error", spec)
+		}
+	}
+}
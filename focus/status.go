@@ -0,0 +1,85 @@
+package focus
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Status is a snapshot of a watcher's state.
+type Status struct {
+	Name                string    `json:"name,omitempty"`
+	Device              string    `json:"device"`
+	WatchedProc         []string  `json:"watched_proc,omitempty"`
+	WatchedModules      []string  `json:"watched_modules,omitempty"`
+	Monitoring          bool      `json:"monitoring"`
+	Paused              bool      `json:"paused"`
+	LastRefocus         time.Time `json:"last_refocus,omitempty"`
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+// MarshalJSON leaves out LastRefocus and LastSuccess while they are zero, as
+// omitempty doesn't for a time.Time.
+func (s Status) MarshalJSON() ([]byte, error) {
+	type status Status
+	out := struct {
+		status
+		LastRefocus *time.Time `json:"last_refocus,omitempty"`
+		LastSuccess *time.Time `json:"last_success,omitempty"`
+	}{status: status(s)}
+	if !s.LastRefocus.IsZero() {
+		out.LastRefocus = &s.LastRefocus
+	}
+	if !s.LastSuccess.IsZero() {
+		out.LastSuccess = &s.LastSuccess
+	}
+	return json.Marshal(out)
+}
+
+// Status returns the watcher's current state. It is safe to call while the
+// watcher is running.
+func (w *Watcher) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return Status{
+		Name:                w.Name,
+		Device:              w.Device,
+		WatchedProc:         w.Processes,
+		WatchedModules:      w.Modules,
+		Monitoring:          w.inUse,
+		Paused:              w.paused.Load(),
+		LastRefocus:         w.lastRefocus,
+		LastSuccess:         w.lastSuccess,
+		LastError:           w.lastError,
+		ConsecutiveFailures: w.failures,
+	}
+}
+
+// recordRefocus updates the status after a refocus attempt.
+func (w *Watcher) recordRefocus(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastRefocus = time.Now()
+	w.attempts++
+	if err != nil {
+		w.lastError = err.Error()
+		w.failures++
+	} else {
+		w.lastSuccess = w.lastRefocus
+		w.successes++
+		w.lastError = ""
+		w.failures = 0
+	}
+}
+
+// logSummary logs what the watcher did since Run started, or the first of the
+// watchers handed over to it did, when it stops.
+func (w *Watcher) logSummary() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.log.Info("Stopped watching", "uptime", time.Since(w.started).Round(time.Second).String(), "checks", w.checks, "refocus_attempts", w.attempts, "successes", w.successes, "failures", w.attempts-w.successes)
+}
@@ -0,0 +1,78 @@
+package focus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusJSON(t *testing.T) {
+	at := time.Date(2024, time.January, 1, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		status Status
+		want   string
+	}{
+		{
+			name:   "never refocused",
+			status: Status{Device: "/dev/video0", Monitoring: true},
+			want:   `{"device":"/dev/video0","monitoring":true,"paused":false,"consecutive_failures":0}`,
+		},
+		{
+			name:   "failing",
+			status: Status{Device: "/dev/video0", LastRefocus: at, LastError: "exit status 1", ConsecutiveFailures: 2},
+			want:   `{"device":"/dev/video0","monitoring":false,"paused":false,"last_error":"exit status 1","consecutive_failures":2,"last_refocus":"2024-01-01T09:30:00Z"}`,
+		},
+		{
+			name:   "refocused",
+			status: Status{Name: "zoom", Device: "/dev/video0", WatchedProc: []string{"zoom"}, LastRefocus: at, LastSuccess: at},
+			want:   `{"name":"zoom","device":"/dev/video0","watched_proc":["zoom"],"monitoring":false,"paused":false,"consecutive_failures":0,"last_refocus":"2024-01-01T09:30:00Z","last_success":"2024-01-01T09:30:00Z"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.status)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("json.Marshal() = %s, want %s", got, tt.want)
+			}
+
+			// A list of statuses, as served on /status, is encoded the same
+			list, err := json.Marshal([]Status{tt.status})
+			if err != nil || !strings.Contains(string(list), tt.want) {
+				t.Errorf("json.Marshal([]Status) = %s, %v, want it to contain %s", list, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummaryOnFatalError(t *testing.T) {
+	var logs bytes.Buffer
+	w, err := NewWatcher(Options{
+		Always:          true,
+		Command:         []string{"refocus"},
+		Runner:          &fakeRunner{results: []fakeResult{{err: errors.New("exit status 1")}}},
+		OnError:         OnErrorExit,
+		CheckInterval:   time.Hour,
+		RefocusInterval: time.Millisecond,
+		Logger:          slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatal("Run() = nil after a refocus failed with OnErrorExit")
+	}
+	const want = `msg="Stopped watching"`
+	if !strings.Contains(logs.String(), want) || !strings.Contains(logs.String(), "refocus_attempts=1 successes=0 failures=1") {
+		t.Errorf("logs = %q, want the summary with the failed attempt", logs.String())
+	}
+}
@@ -0,0 +1,77 @@
+//go:build linux
+
+package focus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// listenUevents listens on the kernel uevent netlink socket and sends the
+// device name, ex: video0, whenever a video4linux device is added or removed.
+// The socket is closed when ctx is cancelled.
+func listenUevents(ctx context.Context) (<-chan string, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, fmt.Errorf("opening uevent socket: %w", err)
+	}
+	// Group 1 receives the events as sent by the kernel
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("binding uevent socket: %w", err)
+	}
+	// Non-blocking so reads use the runtime poller and Close interrupts them
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("opening uevent socket: %w", err)
+	}
+	sock := os.NewFile(uintptr(fd), "uevent")
+
+	go func() {
+		<-ctx.Done()
+		sock.Close()
+	}()
+
+	events := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := sock.Read(buf)
+			if err != nil {
+				return
+			}
+			action, subsystem, devname := parseUevent(buf[:n])
+			if subsystem != "video4linux" || (action != "add" && action != "remove") {
+				continue
+			}
+			select {
+			case events <- devname:
+			default:
+			}
+		}
+	}()
+	return events, nil
+}
+
+// parseUevent returns the action, subsystem and device name of a uevent,
+// which is a header followed by NUL separated KEY=value pairs.
+func parseUevent(msg []byte) (action, subsystem, devname string) {
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		key, value, ok := bytes.Cut(field, []byte{'='})
+		if !ok {
+			continue
+		}
+		switch string(key) {
+		case "ACTION":
+			action = string(value)
+		case "SUBSYSTEM":
+			subsystem = string(value)
+		case "DEVNAME":
+			devname = string(value)
+		}
+	}
+	return action, subsystem, devname
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package focus
+
+import "context"
+
+func listenUevents(ctx context.Context) (<-chan string, error) {
+	return nil, errUnsupported
+}
@@ -0,0 +1,287 @@
+package focus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// V4L2 control IDs from linux/v4l2-controls.h.
+const (
+	v4l2CIDCameraClassBase = 0x009a0900
+
+	// CIDFocusAbsolute is V4L2_CID_FOCUS_ABSOLUTE, focus_absolute in v4l2-ctl.
+	CIDFocusAbsolute uint32 = v4l2CIDCameraClassBase + 10
+	// CIDFocusAuto is V4L2_CID_FOCUS_AUTO, shown by v4l2-ctl as
+	// focus_automatic_continuous or focus_auto depending on the kernel.
+	CIDFocusAuto uint32 = v4l2CIDCameraClassBase + 12
+)
+
+var errUnsupported = errors.New("not supported on this platform")
+
+// Control describes a V4L2 control on a device, as enumerated by
+// ListControls.
+type Control struct {
+	ID uint32
+	// Name is the control name as v4l2-ctl prints it, ex: focus_auto.
+	Name string
+	// Type is the control type, ex: int, bool or menu.
+	Type    string
+	Min     int32
+	Max     int32
+	Step    int32
+	Default int32
+	// Value is the current value, HasValue is false if it couldn't be read,
+	// such as for buttons and write-only controls.
+	Value    int32
+	HasValue bool
+	// Inactive is set for controls that currently have no effect, ex:
+	// focus_absolute while continuous autofocus is on.
+	Inactive bool
+}
+
+// controlName converts a control's description to the name v4l2-ctl uses
+// for it, ex: "Focus, Automatic Continuous" to focus_automatic_continuous.
+func controlName(description string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(description) {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// V4L2Controller refocuses by setting a V4L2 control directly on the device
+// with the VIDIOC_S_CTRL ioctl, without shelling out to v4l2-ctl.
+type V4L2Controller struct {
+	// Device is the camera device, ex: /dev/video0.
+	Device string
+	// Control is the V4L2 control ID to set, ex: CIDFocusAuto.
+	Control uint32
+	// Value is the value to set the control to.
+	Value int32
+	// Force sets the control even when it already holds Value. Without it the
+	// current value is read first and the set skipped when it matches, for
+	// cameras that misreport their state.
+	Force bool
+	// Logger receives the controller's logs, the Watcher's logger unless
+	// set, or slog.Default() outside a Watcher.
+	Logger *slog.Logger
+}
+
+func (c *V4L2Controller) Refocus(ctx context.Context) error {
+	log := loggerOrDefault(c.Logger)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !c.Force {
+		if current, err := getControl(log, c.Device, c.Control); err == nil && current == c.Value {
+			log.Debug("Focus control already set, skipping", "device", c.Device, "control", fmt.Sprintf("%#x", c.Control), "value", c.Value)
+			return nil
+		}
+	}
+	return setControl(log, c.Device, c.Control, c.Value)
+}
+
+func (c *V4L2Controller) String() string {
+	return "native ioctl on " + c.Device
+}
+
+func (c *V4L2Controller) setLogger(log *slog.Logger) {
+	if c.Logger == nil {
+		c.Logger = log
+	}
+}
+
+// NudgeController refocuses cameras with only manual focus by moving
+// focus_absolute one step away from its current value and back, which makes
+// some cameras refocus. The step goes down instead of up at the top of the
+// control's range.
+type NudgeController struct {
+	// Device is the camera device, ex: /dev/video0.
+	Device string
+	// Settle is how long to hold the nudged value before setting it back,
+	// defaults to 100ms.
+	Settle time.Duration
+	// Logger receives the controller's logs, the Watcher's logger unless
+	// set, or slog.Default() outside a Watcher.
+	Logger *slog.Logger
+}
+
+func (c *NudgeController) Refocus(ctx context.Context) error {
+	log := loggerOrDefault(c.Logger)
+	ctrl, err := queryControl(log, c.Device, CIDFocusAbsolute)
+	if err != nil {
+		return err
+	}
+	current, err := getControl(log, c.Device, CIDFocusAbsolute)
+	if err != nil {
+		return err
+	}
+
+	step := ctrl.Step
+	if step <= 0 {
+		step = 1
+	}
+	nudged := current + step
+	if nudged > ctrl.Max || nudged < current {
+		nudged = current - step
+	}
+	if nudged < ctrl.Min || nudged > ctrl.Max {
+		return fmt.Errorf("focus_absolute on %s can't be nudged from %d within its range %d to %d", c.Device, current, ctrl.Min, ctrl.Max)
+	}
+	if ctrl.Inactive {
+		log.Debug("focus_absolute is inactive, is autofocus on?", "device", c.Device)
+	}
+
+	log.Debug("Nudging focus", "device", c.Device, "from", current, "to", nudged)
+	if err := setControl(log, c.Device, CIDFocusAbsolute, nudged); err != nil {
+		return err
+	}
+	settle := c.Settle
+	if settle <= 0 {
+		settle = 100 * time.Millisecond
+	}
+	timer := time.NewTimer(settle)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	// Always set back, even once ctx is done, so focus isn't left nudged
+	return setControl(log, c.Device, CIDFocusAbsolute, current)
+}
+
+func (c *NudgeController) String() string {
+	return "native focus_absolute nudge on " + c.Device
+}
+
+func (c *NudgeController) setLogger(log *slog.Logger) {
+	if c.Logger == nil {
+		c.Logger = log
+	}
+}
+
+// AutofocusControls are the names v4l2-ctl knows the continuous autofocus
+// control by, newer kernels first.
+var AutofocusControls = []string{"focus_automatic_continuous", "focus_auto"}
+
+// V4L2CtlController refocuses by enabling continuous autofocus with v4l2-ctl.
+// The control has been renamed between kernel versions, so each of Controls
+// is tried in turn while v4l2-ctl reports it unknown, and the first that works
+// is used from then on.
+type V4L2CtlController struct {
+	// Device is the camera device, ex: /dev/video0.
+	Device string
+	// Controls are the control names to try, defaults to AutofocusControls.
+	Controls []string
+	// Runner runs v4l2-ctl, defaults to ExecRunner.
+	Runner CommandRunner
+	// Logger receives the controller's logs, the Watcher's logger unless
+	// set, or slog.Default() outside a Watcher.
+	Logger *slog.Logger
+
+	mu     sync.Mutex
+	chosen string
+}
+
+func (c *V4L2CtlController) Refocus(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	log := loggerOrDefault(c.Logger)
+
+	if c.chosen != "" {
+		return c.command(c.chosen).Refocus(ctx)
+	}
+
+	controls := c.Controls
+	if len(controls) == 0 {
+		controls = AutofocusControls
+	}
+	var err error
+	for _, control := range controls {
+		err = c.command(control).Refocus(ctx)
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) && strings.Contains(strings.ToLower(cmdErr.Output), "unknown control") {
+			log.Debug("Autofocus control unknown, trying the next name", "device", c.Device, "control", control)
+			continue
+		}
+		if err == nil {
+			log.Info("Using autofocus control", "device", c.Device, "control", control)
+			c.chosen = control
+		}
+		return err
+	}
+	return err
+}
+
+func (c *V4L2CtlController) command(control string) *CommandController {
+	return &CommandController{Command: V4L2CtlCommand(c.Device, control+"=1"), Runner: c.Runner}
+}
+
+func (c *V4L2CtlController) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.chosen != "" {
+		return strings.Join(V4L2CtlCommand(c.Device, c.chosen+"=1"), " ")
+	}
+	return strings.Join(V4L2CtlCommand(c.Device, "focus_automatic_continuous=1"), " ") + " (or focus_auto on older kernels)"
+}
+
+func (c *V4L2CtlController) setLogger(log *slog.Logger) {
+	if c.Logger == nil {
+		c.Logger = log
+	}
+}
+
+// V4L2CtlCommand returns the v4l2-ctl command setting controls, each as
+// name=value, on device.
+func V4L2CtlCommand(device string, controls ...string) []string {
+	return []string{"v4l2-ctl", "-d", device, "--set-ctrl", strings.Join(controls, ",")}
+}
+
+// FallbackController refocuses with Primary until it fails, then logs the
+// failure and uses Fallback from then on.
+type FallbackController struct {
+	Primary  CameraController
+	Fallback CameraController
+	// Logger receives the controller's logs, the Watcher's logger unless
+	// set, or slog.Default() outside a Watcher.
+	Logger *slog.Logger
+
+	failed atomic.Bool
+}
+
+func (c *FallbackController) Refocus(ctx context.Context) error {
+	if !c.failed.Load() {
+		err := c.Primary.Refocus(ctx)
+		if err == nil {
+			return nil
+		}
+		loggerOrDefault(c.Logger).Warn("Refocus failed, falling back", "controller", fmt.Sprint(c.Primary), "fallback", fmt.Sprint(c.Fallback), "err", err)
+		c.failed.Store(true)
+	}
+	return c.Fallback.Refocus(ctx)
+}
+
+func (c *FallbackController) String() string {
+	return fmt.Sprintf("%v, falling back to %v", c.Primary, c.Fallback)
+}
+
+func (c *FallbackController) setLogger(log *slog.Logger) {
+	if c.Logger == nil {
+		c.Logger = log
+	}
+	setLogger(c.Primary, log)
+	setLogger(c.Fallback, log)
+}
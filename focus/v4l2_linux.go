@@ -0,0 +1,202 @@
+//go:build linux
+
+package focus
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// V4L2 ioctl requests from linux/videodev2.h.
+const (
+	vidiocGCtrl     = 0xc008561b // _IOWR('V', 27, struct v4l2_control)
+	vidiocSCtrl     = 0xc008561c // _IOWR('V', 28, struct v4l2_control)
+	vidiocQueryCtrl = 0xc0445624 // _IOWR('V', 36, struct v4l2_queryctrl)
+
+	v4l2CtrlFlagNextCtrl  = 0x80000000
+	v4l2CtrlFlagDisabled  = 0x0001
+	v4l2CtrlFlagInactive  = 0x0010
+	v4l2CtrlFlagWriteOnly = 0x0040
+)
+
+// V4L2 control types from linux/videodev2.h, by enum v4l2_ctrl_type value.
+var v4l2CtrlTypes = map[uint32]string{
+	1: "int",
+	2: "bool",
+	3: "menu",
+	4: "button",
+	5: "int64",
+	6: "class",
+	7: "string",
+	8: "bitmask",
+	9: "intmenu",
+}
+
+// Opening a device is retried with a doubling delay, as a camera that was just
+// plugged in can briefly be busy or not yet ready.
+const (
+	deviceOpenAttempts = 5
+	deviceOpenBackoff  = 20 * time.Millisecond
+)
+
+// v4l2Control mirrors struct v4l2_control.
+type v4l2Control struct {
+	id    uint32
+	value int32
+}
+
+// v4l2QueryCtrl mirrors struct v4l2_queryctrl.
+type v4l2QueryCtrl struct {
+	id           uint32
+	typ          uint32
+	name         [32]byte
+	minimum      int32
+	maximum      int32
+	step         int32
+	defaultValue int32
+	flags        uint32
+	reserved     [2]uint32
+}
+
+// ListControls enumerates the controls of device with VIDIOC_QUERYCTRL and
+// reads the current value of each. Disabled controls and control class
+// headings are left out.
+func ListControls(device string) ([]Control, error) {
+	f, err := openDevice(slog.Default(), device)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var controls []Control
+	query := v4l2QueryCtrl{id: v4l2CtrlFlagNextCtrl}
+	for {
+		if err := ioctl(f.Fd(), vidiocQueryCtrl, unsafe.Pointer(&query)); err != nil {
+			// EINVAL marks the end of the list
+			if err == syscall.EINVAL {
+				return controls, nil
+			}
+			return nil, fmt.Errorf("querying controls on %s: %w", device, err)
+		}
+
+		typ, ok := v4l2CtrlTypes[query.typ]
+		if !ok {
+			typ = fmt.Sprintf("type %d", query.typ)
+		}
+		if query.flags&v4l2CtrlFlagDisabled == 0 && typ != "class" {
+			name, _, _ := strings.Cut(string(query.name[:]), "\x00")
+			c := Control{
+				ID:       query.id,
+				Name:     controlName(name),
+				Type:     typ,
+				Min:      query.minimum,
+				Max:      query.maximum,
+				Step:     query.step,
+				Default:  query.defaultValue,
+				Inactive: query.flags&v4l2CtrlFlagInactive != 0,
+			}
+			switch typ {
+			case "int", "bool", "menu", "intmenu", "bitmask":
+				if query.flags&v4l2CtrlFlagWriteOnly == 0 {
+					ctrl := v4l2Control{id: query.id}
+					if ioctl(f.Fd(), vidiocGCtrl, unsafe.Pointer(&ctrl)) == nil {
+						c.Value, c.HasValue = ctrl.value, true
+					}
+				}
+			}
+			controls = append(controls, c)
+		}
+
+		query = v4l2QueryCtrl{id: query.id | v4l2CtrlFlagNextCtrl}
+	}
+}
+
+// queryControl describes the control id of device with VIDIOC_QUERYCTRL,
+// without reading its value.
+func queryControl(log *slog.Logger, device string, id uint32) (Control, error) {
+	f, err := openDevice(log, device)
+	if err != nil {
+		return Control{}, err
+	}
+	defer f.Close()
+
+	query := v4l2QueryCtrl{id: id}
+	if err := ioctl(f.Fd(), vidiocQueryCtrl, unsafe.Pointer(&query)); err != nil {
+		return Control{}, fmt.Errorf("querying control %#x on %s: %w", id, device, err)
+	}
+	if query.flags&v4l2CtrlFlagDisabled != 0 {
+		return Control{}, fmt.Errorf("control %#x on %s is disabled", id, device)
+	}
+	name, _, _ := strings.Cut(string(query.name[:]), "\x00")
+	return Control{
+		ID:       query.id,
+		Name:     controlName(name),
+		Min:      query.minimum,
+		Max:      query.maximum,
+		Step:     query.step,
+		Default:  query.defaultValue,
+		Inactive: query.flags&v4l2CtrlFlagInactive != 0,
+	}, nil
+}
+
+func getControl(log *slog.Logger, device string, id uint32) (int32, error) {
+	f, err := openDevice(log, device)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	ctrl := v4l2Control{id: id}
+	if err := ioctl(f.Fd(), vidiocGCtrl, unsafe.Pointer(&ctrl)); err != nil {
+		return 0, fmt.Errorf("getting control %#x on %s: %w", id, device, err)
+	}
+	return ctrl.value, nil
+}
+
+func setControl(log *slog.Logger, device string, id uint32, value int32) error {
+	f, err := openDevice(log, device)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctrl := v4l2Control{id: id, value: value}
+	if err := ioctl(f.Fd(), vidiocSCtrl, unsafe.Pointer(&ctrl)); err != nil {
+		return fmt.Errorf("setting control %#x on %s: %w", id, device, err)
+	}
+	return nil
+}
+
+// openDevice opens device for the control ioctls, retrying a few times while
+// it fails with EBUSY, ENODEV or ENXIO.
+func openDevice(log *slog.Logger, device string) (*os.File, error) {
+	delay := deviceOpenBackoff
+	for attempt := 1; ; attempt++ {
+		f, err := os.OpenFile(device, os.O_RDWR|syscall.O_NONBLOCK, 0)
+		if err == nil || attempt == deviceOpenAttempts || !transientOpenError(err) {
+			return f, err
+		}
+		log.Debug("Error opening device, retrying", "device", device, "attempt", attempt, "delay", delay.String(), "err", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// transientOpenError reports whether err opening a device is likely to go
+// away on its own shortly.
+func transientOpenError(err error) bool {
+	return errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.ENODEV) || errors.Is(err, syscall.ENXIO)
+}
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
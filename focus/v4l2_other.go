@@ -0,0 +1,22 @@
+//go:build !linux
+
+package focus
+
+import "log/slog"
+
+func queryControl(log *slog.Logger, device string, id uint32) (Control, error) {
+	return Control{}, errUnsupported
+}
+
+func getControl(log *slog.Logger, device string, id uint32) (int32, error) {
+	return 0, errUnsupported
+}
+
+func setControl(log *slog.Logger, device string, id uint32, value int32) error {
+	return errUnsupported
+}
+
+// ListControls is only supported on Linux.
+func ListControls(device string) ([]Control, error) {
+	return nil, errUnsupported
+}
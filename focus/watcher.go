@@ -0,0 +1,1150 @@
+// Package focus watches for a camera to be in use and, while it is, runs a
+// command on an interval to tell the camera to refocus.
+package focus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/rand"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCmdTimeout is how long a refocus may take when CmdTimeout isn't set.
+const DefaultCmdTimeout = 5 * time.Second
+
+// shutdownTimeout bounds how long Run waits for an in-flight refocus command
+// to finish once its context is cancelled.
+const shutdownTimeout = 10 * time.Second
+
+// Detection modes used to decide whether the camera is in use.
+const (
+	DetectProc   = "proc"
+	DetectModule = "module"
+	DetectFD     = "fd"
+	DetectFuser  = "fuser"
+	// DetectEvent matches processes like DetectProc but also checks right
+	// away when a matching process starts or the matched one exits, using the
+	// Linux proc connector. It needs CAP_NET_ADMIN, without it only polling
+	// is used.
+	DetectEvent = "event"
+	// DetectAudio reports in use while any application records audio,
+	// according to PulseAudio or PipeWire through pactl. Best combined with
+	// other modes.
+	DetectAudio = "audio"
+	// DetectPid reports in use while the process Pid is running, without
+	// listing every process.
+	DetectPid = "pid"
+)
+
+// Failure policies deciding what happens once MaxFailures refocus attempts in
+// a row have failed.
+const (
+	FailureExit  = "exit"
+	FailureAlert = "alert"
+)
+
+// Error policies deciding what happens after each failed refocus attempt.
+const (
+	OnErrorBackoff  = "backoff"
+	OnErrorContinue = "continue"
+	OnErrorExit     = "exit"
+)
+
+// Match modes deciding how the results of several detection modes are
+// combined.
+const (
+	MatchAny = "any"
+	MatchAll = "all"
+)
+
+// ErrTooManyFailures is returned by Run when MaxFailures refocus attempts in a
+// row failed with FailurePolicy FailureExit.
+var ErrTooManyFailures = errors.New("too many refocus failures in a row")
+
+// ErrRefocusFailed is returned by Run when a refocus attempt failed with
+// OnError OnErrorExit.
+var ErrRefocusFailed = errors.New("refocus failed")
+
+// ErrNothingToWatch is returned by Validate when no detection mode could be
+// derived because no processes, process ID or modules were given.
+var ErrNothingToWatch = errors.New("either process, process ID or module is required")
+
+// Options configure a Watcher, see NewWatcher. Zero values fall back to the
+// defaults described for each field when the watcher is validated.
+type Options struct {
+	// Name identifies the watcher in logs when several are running.
+	Name string
+	// Device is the camera device, ex: /dev/video0.
+	Device string
+	// Detect lists the detection modes to use. When empty Validate fills it
+	// with DetectProc if Processes is set and DetectModule if Modules is set
+	// and ProcFSSupported.
+	Detect []string
+	// Always treats the camera as always in use, refocusing every
+	// RefocusInterval without any detection. Detect, Processes and Modules
+	// are ignored.
+	Always bool
+	// Schedule, if set, limits when the watcher is active, in local time.
+	// Outside it the camera is treated as not in use, without checking.
+	Schedule *Schedule
+	// Inhibitors can hold off refocusing, ex: while the screen is locked. If
+	// any reports inhibited the camera is treated as not in use, without
+	// checking.
+	Inhibitors []Inhibitor
+	// MatchMode is MatchAny (default) or MatchAll.
+	MatchMode string
+	// Processes are the process names to watch for, matched by ProcMatch.
+	Processes []string
+	// Pid is a process ID to watch for DetectPid.
+	Pid int
+	// ProcMatch is how Processes are compared, defaults to ProcMatchExact.
+	ProcMatch string
+	// ProcMatchCmdline matches Processes against the full command line rather
+	// than the executable name.
+	ProcMatchCmdline bool
+	// OwnProcessesOnly only matches Processes run by the same user as this
+	// one, by their real uid, so another user's apps on a shared machine
+	// don't count. Linux only, elsewhere it is ignored.
+	OwnProcessesOnly bool
+	// Modules are the kernel modules to watch for a non-zero usage count.
+	Modules []string
+
+	// Controller refocuses the camera. When nil Validate sets it to a
+	// CommandController running Command with Runner.
+	Controller CameraController
+	// Command is the refocus command and its arguments, used when Controller
+	// is nil.
+	Command []string
+	// CheckInterval is how often to check if the camera is in use.
+	CheckInterval time.Duration
+	// ProcInterval and ModuleInterval, if set, are how often the proc (and
+	// event) and module modes run instead of every CheckInterval. Checks in
+	// between a longer interval reuse the mode's last result. A shorter one
+	// polls the mode on its own while the camera isn't in use and checks right
+	// away once the mode finds it in use.
+	ProcInterval   time.Duration
+	ModuleInterval time.Duration
+	// RefocusInterval is how often to run Command while the camera is in use.
+	RefocusInterval time.Duration
+	// BatteryRefocusInterval, if set, replaces RefocusInterval while the
+	// system is running on battery. Linux only, elsewhere it is ignored.
+	BatteryRefocusInterval time.Duration
+	// CmdTimeout is how long each refocus may take before it is cancelled,
+	// defaults to DefaultCmdTimeout.
+	CmdTimeout time.Duration
+	// Cooldown is how long the camera must be found not in use before
+	// refocusing stops and OnStop runs, so an app briefly lingering or
+	// restarting doesn't flap between in use and not.
+	Cooldown time.Duration
+	// Warmup, if set, replaces the delay before the first refocus after the
+	// camera starts being used, for cameras that ignore focus commands while
+	// initializing. Must be less than CheckInterval.
+	Warmup time.Duration
+	// Burst, if set, refocuses this many times BurstGap apart when the camera
+	// starts being used, after any Warmup, before settling into the refocus
+	// interval, for cameras needing a few nudges to lock focus.
+	Burst    int
+	BurstGap time.Duration
+	// Jitter randomizes each delay between refocus attempts by up to this
+	// fraction either way, ex: 0.1 for ±10%, so several watchers don't run
+	// their commands at the same moment. Must be in [0, 1).
+	Jitter float64
+	// MaxBackoff caps the delay between refocus attempts while they keep
+	// failing. The delay doubles from RefocusInterval with each failure in a
+	// row and resets on success. Defaults to CheckInterval.
+	MaxBackoff time.Duration
+	// StaleAfter, if set, logs a warning when the camera has been in use this
+	// long without a successful refocus, for commands that keep failing or
+	// cameras that stop responding.
+	StaleAfter time.Duration
+	// OnError is what happens after each failed refocus attempt:
+	// OnErrorBackoff (default) backs off as described for MaxBackoff,
+	// OnErrorContinue keeps refocusing every RefocusInterval and OnErrorExit
+	// makes Run return ErrRefocusFailed. MaxFailures applies on top of
+	// backoff and continue.
+	OnError string
+	// MaxFailures, if set, is how many refocus attempts in a row may fail
+	// before FailurePolicy applies.
+	MaxFailures int
+	// FailurePolicy is FailureExit (default) to make Run return
+	// ErrTooManyFailures, or FailureAlert to run AlertCommand once, and again
+	// only after a success.
+	FailurePolicy string
+	// AlertCommand is run with Runner for FailureAlert.
+	AlertCommand []string
+	// PreHook and PostHook are run with Runner right before and after each
+	// refocus, each given CmdTimeout. PostHook runs whether or not the
+	// refocus succeeded. Hook failures are logged, and a PreHook failure
+	// skips the refocus if HookStrict is set.
+	PreHook    []string
+	PostHook   []string
+	HookStrict bool
+	// OnStart and OnStop are run with Runner once when the camera starts
+	// being used and once when it stops, including when paused or shutting
+	// down while in use.
+	OnStart []string
+	OnStop  []string
+	// Notifier, if set, is told when refocusing starts and stops.
+	Notifier Notifier
+	// DryRun logs what would be refocused instead of refocusing.
+	DryRun bool
+	// Uevents checks right away whenever Device is added or removed,
+	// as reported by the kernel uevent netlink socket, rather than waiting for
+	// the next CheckInterval. Polling continues, as it is still needed to
+	// notice apps opening the camera. Linux only, if the socket can't be
+	// opened a warning is logged and only polling is used.
+	Uevents bool
+
+	// InitialDelay, if set, is how long Run waits before the first check, ex:
+	// for the desktop session and camera to be ready after boot.
+	InitialDelay time.Duration
+	// DetectTimeout, if set, bounds how long the detection modes may take
+	// to decide whether the camera is in use, ex: reading the process list
+	// on a heavily loaded system. A check that times out is skipped, leaving
+	// the state as it was, and so are later ones until it finishes.
+	DetectTimeout time.Duration
+	// Lister lists running processes, defaults to using go-ps.
+	Lister ProcessLister
+	// Proc is the /proc filesystem, defaults to /proc. DetectFD needs it to
+	// be a ReadLinkFS.
+	Proc fs.FS
+	// ModuleChecker checks whether Modules are in use, defaults to
+	// ProcModules reading Proc on Linux.
+	ModuleChecker ModuleChecker
+	// Runner runs Command when Controller is nil, defaults to ExecRunner.
+	Runner CommandRunner
+	// Logger receives the watcher's logs, defaults to slog.Default(). Name is
+	// added to every record as the "rule" attribute.
+	Logger *slog.Logger
+	// Metrics, if set, records refocus statistics.
+	Metrics *Metrics
+	// Callbacks are called when the camera starts and stops being used and
+	// after each refocus.
+	Callbacks Callbacks
+}
+
+// Watcher checks whether the camera is in use every CheckInterval and, while
+// it is, runs Command every RefocusInterval. Create one with NewWatcher; a
+// Watcher with its Options set directly works too, they are validated by Run.
+//
+// Run blocks and is called once, from one goroutine, and the Options must not
+// be changed while it runs. Status, Pause, Resume and CheckNow are safe to call
+// from other goroutines at any time. Validate, InUse, Matched and Refocus are
+// for using a watcher without Run, ex: to check once, and mustn't be called
+// while it runs. The Controller, hooks and Notifier are only ever called from
+// one goroutine at a time.
+type Watcher struct {
+	Options
+
+	log           *slog.Logger
+	procMatches   func(name string) bool
+	matched       string
+	cancelRefocus context.CancelFunc
+	wg            sync.WaitGroup
+	paused        atomic.Bool
+	// detecting is set while InUse runs with DetectTimeout
+	detecting atomic.Bool
+	// moduleMissing is set once none of Modules was found loaded, so that is
+	// only warned about once
+	moduleMissing atomic.Bool
+	// moduleFailing is set once reading the modules list has failed, so that
+	// is only logged as an error once until it succeeds again
+	moduleFailing atomic.Bool
+	// matchedPid is the process last matched by isProcessRunning and
+	// exitedPid one that has exited but may not have been reaped yet
+	matchedPid int
+	exitedPid  int
+	// deviceTarget is the device Device last resolved to, for the uevents
+	// of a Device that is a symlink
+	deviceTarget string
+	// polled holds the last result of the modes with their own interval
+	polled map[string]polledResult
+	// lastInUse is when the camera was last found in use, for Cooldown
+	lastInUse time.Time
+	// interval is the refocus interval for the current check, RefocusInterval
+	// or BatteryRefocusInterval when onBattery
+	interval  time.Duration
+	onBattery bool
+	// idle is set while outside Schedule and inhibitedBy to the position in
+	// Inhibitors, plus one, of the inhibitor holding off refocusing
+	idle        bool
+	inhibitedBy int
+	// wake makes Run check right away, after pausing or resuming
+	wake chan struct{}
+	// fatal receives the error ending Run from the refocus loop
+	fatal chan error
+	// callbacks queues the Callbacks to call while Run runs
+	callbacks chan func()
+	// handOver is the watcher taking over from this one, see HandOver
+	handOver atomic.Pointer[Watcher]
+
+	// mu guards the state reported by Status
+	mu          sync.Mutex
+	inUse       bool
+	inUseSince  time.Time
+	lastRefocus time.Time
+	lastSuccess time.Time
+	staleWarned bool
+	lastError   string
+	failures    int
+	// started is when Run started and the rest count what it did since, for
+	// the summary logged when it stops
+	started   time.Time
+	checks    int
+	attempts  int
+	successes int
+}
+
+// NewWatcher returns a watcher configured by opts, checked with Validate so a
+// bad configuration is reported before Run, which checks the intervals, ex:
+//
+//	w, err := focus.NewWatcher(focus.Options{
+//		Device:          "/dev/video0",
+//		Processes:       []string{"zoom"},
+//		CheckInterval:   30 * time.Second,
+//		RefocusInterval: 10 * time.Second,
+//		Command:         focus.V4L2CtlCommand("/dev/video0", "focus_automatic_continuous=1"),
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	return w.Run(ctx)
+func NewWatcher(opts Options) (*Watcher, error) {
+	w := &Watcher{Options: opts}
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Validate fills in defaults and checks the Watcher's configuration. It is
+// called by Run but may be called beforehand to report errors early or to see
+// the derived detection modes.
+func (w *Watcher) Validate() error {
+	if w.MatchMode == "" {
+		w.MatchMode = MatchAny
+	}
+	if w.ProcMatch == "" {
+		w.ProcMatch = ProcMatchExact
+	}
+	if w.Lister == nil {
+		w.Lister = psLister{}
+	}
+	if w.Proc == nil {
+		w.Proc = procDir("/proc")
+	}
+	if w.ModuleChecker == nil {
+		w.ModuleChecker = defaultModuleChecker(w.Proc)
+	}
+	if w.Runner == nil {
+		w.Runner = ExecRunner{}
+	}
+	if w.Logger == nil {
+		w.Logger = slog.Default()
+	}
+	if w.wake == nil {
+		w.wake = make(chan struct{}, 1)
+	}
+	if w.fatal == nil {
+		w.fatal = make(chan error, 1)
+	}
+	if w.FailurePolicy == "" {
+		w.FailurePolicy = FailureExit
+	}
+	if w.OnError == "" {
+		w.OnError = OnErrorBackoff
+	}
+	if w.CmdTimeout <= 0 {
+		w.CmdTimeout = DefaultCmdTimeout
+	}
+	w.log = w.Logger
+	if w.Name != "" {
+		w.log = w.Logger.With("rule", w.Name)
+	}
+
+	if w.Controller == nil {
+		if len(w.Command) == 0 {
+			return errors.New("refocus command is required")
+		}
+		w.Controller = &CommandController{Command: w.Command, Runner: w.Runner}
+	}
+	setLogger(w.Controller, w.log)
+
+	if w.FailurePolicy != FailureExit && w.FailurePolicy != FailureAlert {
+		return fmt.Errorf("invalid failure policy %q, must be %q or %q", w.FailurePolicy, FailureExit, FailureAlert)
+	}
+	if w.FailurePolicy == FailureAlert && w.MaxFailures > 0 && len(w.AlertCommand) == 0 {
+		return errors.New("alert failure policy requires an alert command")
+	}
+
+	if w.OnError != OnErrorBackoff && w.OnError != OnErrorContinue && w.OnError != OnErrorExit {
+		return fmt.Errorf("invalid error policy %q, must be one of: %s, %s, %s", w.OnError, OnErrorBackoff, OnErrorContinue, OnErrorExit)
+	}
+
+	if w.Burst < 0 || (w.Burst > 0 && w.BurstGap <= 0) {
+		return fmt.Errorf("burst must be at least 0 with a gap greater than zero, got %d and %s", w.Burst, w.BurstGap.String())
+	}
+
+	if w.Jitter < 0 || w.Jitter >= 1 {
+		return fmt.Errorf("jitter must be at least 0 and less than 1, got %g", w.Jitter)
+	}
+
+	if w.MatchMode != MatchAny && w.MatchMode != MatchAll {
+		return fmt.Errorf("invalid match mode %q, must be %q or %q", w.MatchMode, MatchAny, MatchAll)
+	}
+
+	if w.Always {
+		w.Detect = nil
+		return nil
+	}
+
+	if len(w.Detect) == 0 {
+		if w.Pid > 0 {
+			w.Detect = append(w.Detect, DetectPid)
+		}
+		if len(w.Processes) > 0 {
+			w.Detect = append(w.Detect, DetectProc)
+		}
+		if len(w.Modules) > 0 && procFSSupported {
+			w.Detect = append(w.Detect, DetectModule)
+		}
+	}
+	if len(w.Detect) == 0 {
+		return ErrNothingToWatch
+	}
+	for _, mode := range w.Detect {
+		switch mode {
+		case DetectProc, DetectEvent:
+			if len(w.Processes) == 0 {
+				return fmt.Errorf("%s detection requires a process to watch", mode)
+			}
+			var err error
+			if w.procMatches, err = newProcMatcher(w.ProcMatch, w.Processes); err != nil {
+				return err
+			}
+		case DetectModule, DetectFD:
+			if !procFSSupported {
+				return fmt.Errorf("%s detection: %w", mode, errUnsupported)
+			}
+			if mode == DetectModule && len(w.Modules) == 0 {
+				return errors.New("module detection requires a module to watch")
+			}
+			if _, ok := w.Proc.(ReadLinkFS); mode == DetectFD && !ok {
+				return errors.New("fd detection requires a Proc that can read links, see ReadLinkFS")
+			}
+		case DetectPid:
+			if w.Pid <= 0 {
+				return errors.New("pid detection requires a process ID to watch")
+			}
+		case DetectFuser, DetectAudio:
+		default:
+			return fmt.Errorf("invalid detection mode %q, must be one of: %s", mode, strings.Join([]string{DetectProc, DetectModule, DetectFD, DetectFuser, DetectEvent, DetectAudio, DetectPid}, ", "))
+		}
+	}
+
+	return nil
+}
+
+// Run checks whether the camera is in use right away and then every
+// CheckInterval, running the refocus loop while it is. It blocks until ctx is
+// cancelled, then waits a bounded time for an in-flight refocus to finish.
+func (w *Watcher) Run(ctx context.Context) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	if w.RefocusInterval <= 0 {
+		return fmt.Errorf("refocus interval must be greater than zero, got %s", w.RefocusInterval.String())
+	}
+	if w.CheckInterval <= w.RefocusInterval {
+		return fmt.Errorf("check interval (%s) must be greater than refocus interval (%s)", w.CheckInterval.String(), w.RefocusInterval.String())
+	}
+	if w.BatteryRefocusInterval < 0 || (w.BatteryRefocusInterval > 0 && w.CheckInterval <= w.BatteryRefocusInterval) {
+		return fmt.Errorf("battery refocus interval (%s) must be greater than zero and less than check interval (%s)", w.BatteryRefocusInterval.String(), w.CheckInterval.String())
+	}
+	if w.ProcInterval < 0 || w.ModuleInterval < 0 {
+		return fmt.Errorf("proc and module intervals can't be negative, got %s and %s", w.ProcInterval.String(), w.ModuleInterval.String())
+	}
+	if w.Warmup >= w.CheckInterval {
+		return fmt.Errorf("warmup (%s) must be less than check interval (%s)", w.Warmup.String(), w.CheckInterval.String())
+	}
+
+	if w.Metrics != nil {
+		w.mu.Lock()
+		inUse := w.inUse
+		w.mu.Unlock()
+		w.Metrics.setMonitoring(w.Name, inUse)
+	}
+	defer w.startCallbacks()()
+	w.mu.Lock()
+	// Handed over to, the watcher carries on from when the first started
+	if w.started.IsZero() {
+		w.started = time.Now()
+	}
+	w.mu.Unlock()
+
+	if w.InitialDelay > 0 {
+		w.log.Info("Waiting before the first check", "delay", w.InitialDelay.String())
+		timer := time.NewTimer(w.InitialDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		}
+	}
+
+	var uevents <-chan string
+	if w.Uevents {
+		var err error
+		if uevents, err = listenUevents(ctx); err != nil {
+			w.log.Warn("Can't listen for device events, falling back to polling", "err", err)
+		}
+		w.deviceTarget, _ = filepath.EvalSymlinks(w.Device)
+	}
+
+	var procEvents <-chan procEvent
+	for _, mode := range w.Detect {
+		if mode != DetectEvent {
+			continue
+		}
+		var err error
+		if procEvents, err = listenProcEvents(ctx); err != nil {
+			w.log.Warn("Can't listen for process events, falling back to polling", "err", err)
+		}
+	}
+
+	// Check right away rather than waiting a full interval for the first tick
+	w.check(ctx)
+
+	ticker := time.NewTicker(w.CheckInterval)
+	defer ticker.Stop()
+
+	// Modes polled more often than CheckInterval get their own ticker
+	pollers := map[string]<-chan time.Time{}
+	for _, mode := range w.Detect {
+		if mode == DetectEvent {
+			mode = DetectProc
+		}
+		if interval := w.modeInterval(mode); interval > 0 && interval < w.CheckInterval && pollers[mode] == nil {
+			poll := time.NewTicker(interval)
+			defer poll.Stop()
+			pollers[mode] = poll.C
+		}
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			w.check(ctx)
+		case <-w.wake:
+			w.check(ctx)
+			ticker.Reset(w.CheckInterval)
+		case event := <-procEvents:
+			if !w.procEventMatters(event) {
+				continue
+			}
+			w.check(ctx)
+			w.exitedPid = 0
+			ticker.Reset(w.CheckInterval)
+		case <-pollers[DetectProc]:
+			if w.pollInUse(DetectProc) {
+				w.check(ctx)
+				ticker.Reset(w.CheckInterval)
+			}
+		case <-pollers[DetectModule]:
+			if w.pollInUse(DetectModule) {
+				w.check(ctx)
+				ticker.Reset(w.CheckInterval)
+			}
+		case devname := <-uevents:
+			if !w.ueventMatches(devname) {
+				w.log.Debug("Other video device added or removed, ignoring", "devname", devname)
+				continue
+			}
+			w.log.Debug("Video device added or removed, checking", "devname", devname)
+			w.check(ctx)
+			ticker.Reset(w.CheckInterval)
+		case err := <-w.fatal:
+			// Shut down as when cancelled, the refocus loop has already
+			// stopped
+			w.stopRefocus()
+			w.finish()
+			return err
+		case <-ctx.Done():
+			if !waitTimeout(&w.wg, shutdownTimeout) {
+				w.log.Warn("Refocus still running, exiting anyway", "timeout", shutdownTimeout.String())
+			}
+			// Handing over, the next watcher carries on with the camera in
+			// use or runs the hooks once it finds it isn't
+			if next := w.handOver.Load(); next != nil {
+				w.handOverTo(next)
+				w.log.Debug("Handed over to the next watcher")
+				return nil
+			}
+			w.finish()
+			return nil
+		}
+	}
+}
+
+// finish runs OnStop and the stop callback if the camera is in use, as Run
+// returns, and logs the run summary.
+func (w *Watcher) finish() {
+	w.mu.Lock()
+	inUse := w.inUse
+	w.mu.Unlock()
+	if inUse {
+		w.runHook("stop", w.OnStop)
+		if w.Callbacks.OnStop != nil {
+			w.callback(w.Callbacks.OnStop)
+		}
+	}
+	w.logSummary()
+}
+
+// check stops the previous refocus loop, waiting for it to fully exit, and
+// starts a new one if the camera is in use. Only one refocus loop is ever
+// active and every refocus context is cancelled deterministically. If
+// detection can't tell whether the camera is in use the previous loop is left
+// running, carrying on as before.
+func (w *Watcher) check(ctx context.Context) {
+	w.mu.Lock()
+	w.checks++
+	w.mu.Unlock()
+	interval := w.RefocusInterval
+	if w.BatteryRefocusInterval > 0 {
+		onBattery, err := onBattery()
+		if err != nil {
+			w.log.Debug("Error reading power supply status", "err", err)
+		}
+		if onBattery != w.onBattery {
+			if onBattery {
+				w.log.Info("On battery, refocusing less often", "interval", w.BatteryRefocusInterval.String())
+			} else {
+				w.log.Info("On AC power, refocusing at the normal interval", "interval", w.RefocusInterval.String())
+			}
+			w.onBattery = onBattery
+		}
+		if onBattery {
+			interval = w.BatteryRefocusInterval
+		}
+	}
+
+	idle := w.Schedule != nil && !w.Schedule.Active(time.Now())
+	if idle != w.idle {
+		if idle {
+			w.log.Info("Outside schedule, idle until the next window", "schedule", w.Schedule.String())
+		} else {
+			w.log.Info("Schedule window started, watching", "schedule", w.Schedule.String())
+		}
+		w.idle = idle
+	}
+
+	inhibitedBy := w.inhibited()
+	if inhibitedBy != w.inhibitedBy {
+		if inhibitedBy != 0 {
+			w.log.Info("Refocusing inhibited", "by", fmt.Sprint(w.Inhibitors[inhibitedBy-1]))
+		} else {
+			w.log.Info("No longer inhibited, watching", "by", fmt.Sprint(w.Inhibitors[w.inhibitedBy-1]))
+		}
+		w.inhibitedBy = inhibitedBy
+	}
+
+	// While paused, idle or inhibited the camera is treated as not in use,
+	// without checking
+	inactive := w.paused.Load() || idle || inhibitedBy != 0
+	inUse := false
+	if !inactive {
+		var ok bool
+		if inUse, ok = w.detect(ctx); !ok {
+			return
+		}
+		if inUse {
+			w.log.Debug("Checked, camera in use", "detect", w.Detect, "matched", w.matched)
+		} else {
+			w.log.Debug("Checked, camera not in use", "detect", w.Detect)
+		}
+	}
+	// Detection has settled it, so the previous loop can be replaced
+	w.stopRefocus()
+	w.interval = interval
+	if inUse {
+		w.lastInUse = time.Now()
+	} else if w.inUse && !inactive && time.Since(w.lastInUse) < w.Cooldown {
+		w.log.Debug("Camera not in use, waiting for cooldown", "cooldown", w.Cooldown.String())
+		inUse = true
+	}
+	w.mu.Lock()
+	changed := inUse != w.inUse
+	w.inUse = inUse
+	if changed && inUse {
+		w.inUseSince = time.Now()
+	}
+	w.mu.Unlock()
+	if changed {
+		if inUse {
+			w.log.Info("Camera in use, starting refocus", "device", w.Device, "matched", w.matched, "interval", w.interval.String())
+		} else if w.paused.Load() {
+			w.log.Info("Paused, stopped refocusing", "device", w.Device)
+		} else if inactive {
+			w.log.Info("Inactive, stopped refocusing", "device", w.Device)
+		} else {
+			w.log.Info("Camera no longer in use, stopped refocusing", "device", w.Device)
+		}
+		if w.Metrics != nil {
+			w.Metrics.setMonitoring(w.Name, inUse)
+		}
+		if inUse {
+			w.notify("Camera in use", "Refocusing "+w.Device+" every "+w.interval.String())
+			if onStart, matched := w.Callbacks.OnStart, w.matched; onStart != nil {
+				w.callback(func() { onStart(matched) })
+			}
+			w.runHook("start", w.OnStart)
+		} else {
+			w.notify("Camera no longer in use", "Stopped refocusing "+w.Device)
+			w.runHook("stop", w.OnStop)
+			if w.Callbacks.OnStop != nil {
+				w.callback(w.Callbacks.OnStop)
+			}
+		}
+	}
+	if !inUse {
+		return
+	}
+
+	first := w.refocusDelay()
+	timeout := w.CheckInterval - w.interval
+	burst := 0
+	if changed && w.Warmup > 0 {
+		first = w.Warmup
+	}
+	if changed && w.Burst > 0 {
+		if w.Warmup <= 0 {
+			first = 0
+		}
+		burst = w.Burst
+	}
+	// The next check stops the loop if the warmup or burst runs past the
+	// timeout
+	if changed && (w.Warmup > 0 || burst > 0) && first+time.Duration(burst)*w.BurstGap >= timeout {
+		timeout = w.CheckInterval
+	}
+	if changed {
+		w.log.Debug("Refocus loop started", "first", first.String(), "until", timeout.String())
+	} else {
+		w.log.Debug("Refocus loop restarted", "first", first.String(), "until", timeout.String())
+	}
+	// The loop gets its own copy of the matched process, as the next
+	// detection sets it while the loop runs
+	pid := w.matchedPid
+	xctx, cancel := context.WithTimeout(ctx, timeout)
+	w.cancelRefocus = cancel
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer w.recoverRefocus(xctx)
+		w.refocusLoop(xctx, first, burst, pid)
+	}()
+}
+
+// recoverRefocus, deferred by the refocus loop, recovers from a panic in it,
+// ex: in a controller, so refocusing doesn't stop for good. The panic is
+// logged as a failed refocus and Run woken up to check again, which starts a
+// new loop.
+func (w *Watcher) recoverRefocus(ctx context.Context) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	w.log.Error("Refocus loop panicked, restarting it", "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+	// Counted as a failed refocus so the status and health check show it
+	w.recordRefocus(fmt.Errorf("refocus loop panicked: %v", r))
+	if ctx.Err() == nil {
+		w.wakeUp()
+	}
+}
+
+// Pause stops refocusing, cancelling any active refocus loop, until Resume is
+// called. The watcher keeps running but takes no action while paused. It is
+// safe to call while the watcher is running.
+func (w *Watcher) Pause() {
+	w.paused.Store(true)
+	w.wakeUp()
+}
+
+// Resume undoes Pause, checking whether the camera is in use right away.
+func (w *Watcher) Resume() {
+	w.paused.Store(false)
+	w.wakeUp()
+}
+
+// Paused reports whether the watcher is paused.
+func (w *Watcher) Paused() bool {
+	return w.paused.Load()
+}
+
+// HandOver makes next take over from w, ex: after reloading the config. Call
+// it before cancelling w's Run and start next's once it has returned. Rather
+// than running OnStop and the stop callback when it stops, w passes on whether
+// the camera is in use, so next doesn't run OnStart either. The hooks only run
+// when next finds the camera has really started or stopped being used. The
+// status and the totals logged when the watcher stops carry on too, so they
+// cover every reload.
+func (w *Watcher) HandOver(next *Watcher) {
+	w.handOver.Store(next)
+}
+
+// handOverTo passes on w's state to next: whether the camera is in use, the
+// refocus status and the counts logged when the watcher stops, which carry on
+// across reloads.
+func (w *Watcher) handOverTo(next *Watcher) {
+	w.mu.Lock()
+	inUse, since := w.inUse, w.inUseSince
+	lastRefocus, lastSuccess, lastError, failures := w.lastRefocus, w.lastSuccess, w.lastError, w.failures
+	started, checks, attempts, successes := w.started, w.checks, w.attempts, w.successes
+	w.mu.Unlock()
+
+	next.mu.Lock()
+	next.inUse, next.inUseSince = inUse, since
+	next.lastRefocus, next.lastSuccess, next.lastError, next.failures = lastRefocus, lastSuccess, lastError, failures
+	next.started, next.checks, next.attempts, next.successes = started, checks, attempts, successes
+	next.mu.Unlock()
+	next.lastInUse = w.lastInUse
+}
+
+// CheckNow makes Run check whether the camera is in use right away instead of
+// at the next CheckInterval. It is safe to call while the watcher is running.
+func (w *Watcher) CheckNow() {
+	w.wakeUp()
+}
+
+func (w *Watcher) wakeUp() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Watcher) stopRefocus() {
+	if w.cancelRefocus == nil {
+		return
+	}
+	w.cancelRefocus()
+	w.wg.Wait()
+	w.cancelRefocus = nil
+}
+
+// InUse reports whether the camera is in use according to the detection
+// modes. With MatchAny one of them being in use is enough, with MatchAll every
+// mode must report in use. With Always it is always in use. When a mode can't
+// tell, ex: the modules list can't be read, it is reported not in use.
+func (w *Watcher) InUse() bool {
+	inUse, _ := w.inUseContext(context.Background())
+	return inUse
+}
+
+// inUseContext is InUse, killing the commands the detection modes run once ctx
+// is done. ok is false if a mode couldn't tell whether the camera is in use
+// and the others don't settle it.
+func (w *Watcher) inUseContext(ctx context.Context) (inUse, ok bool) {
+	w.matched = ""
+	w.matchedPid = 0
+	if w.Always {
+		w.matched = "always on"
+		return true, true
+	}
+	// proc and event modes share one scan of the process list
+	var procRunning *bool
+	unknown := false
+	for _, mode := range w.Detect {
+		inUse, ok := false, true
+		switch mode {
+		case DetectProc, DetectEvent:
+			if procRunning == nil {
+				running, _ := w.polledMode(DetectProc, known(w.isProcessRunning))
+				procRunning = &running
+			}
+			inUse = *procRunning
+		case DetectModule:
+			inUse, ok = w.polledMode(DetectModule, w.isModuleInUse)
+		case DetectFD:
+			inUse = w.isDeviceOpen()
+		case DetectFuser:
+			inUse = w.isDeviceInUseFuser(ctx)
+		case DetectAudio:
+			inUse = w.isAudioCaptured(ctx)
+		case DetectPid:
+			inUse = w.isPidWatchedRunning()
+		}
+
+		if !ok {
+			unknown = true
+			continue
+		}
+		if w.MatchMode == MatchAny && inUse {
+			return true, true
+		}
+		if w.MatchMode == MatchAll && !inUse {
+			return false, true
+		}
+	}
+	return w.MatchMode == MatchAll && len(w.Detect) > 0 && !unknown, !unknown
+}
+
+// detect runs InUse, bounded by DetectTimeout. ok is false if a detection mode
+// couldn't tell, it timed out, or an earlier detection that timed out is still
+// running, so whether the camera is in use isn't known.
+func (w *Watcher) detect(ctx context.Context) (inUse, ok bool) {
+	if w.DetectTimeout <= 0 {
+		return w.inUseContext(ctx)
+	}
+	if !w.detecting.CompareAndSwap(false, true) {
+		w.log.Warn("Previous detection still running, skipping check")
+		return false, false
+	}
+
+	// Cancelled on return, which kills the commands of a detection that timed
+	// out
+	detectCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type detected struct{ inUse, ok bool }
+	result := make(chan detected, 1)
+	go func() {
+		inUse, ok := w.inUseContext(detectCtx)
+		w.detecting.Store(false)
+		result <- detected{inUse, ok}
+	}()
+
+	timer := time.NewTimer(w.DetectTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-result:
+		return r.inUse, r.ok
+	case <-timer.C:
+		w.log.Warn("Detection timed out, skipping check", "timeout", w.DetectTimeout.String())
+	case <-ctx.Done():
+	}
+	return false, false
+}
+
+// refocusLoop refocuses after first, then burst-1 more times BurstGap apart,
+// and then every refocusDelay until ctx is done or the matched process pid
+// exits.
+func (w *Watcher) refocusLoop(ctx context.Context, first time.Duration, burst int, pid int) {
+	timer := time.NewTimer(first)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			if !w.stillRunning(pid) {
+				w.log.Debug("Matched process exited, stopping refocus", "pid", pid)
+				w.wakeUp()
+				return
+			}
+			if err := w.Refocus(); err != nil && (w.exitOnError(err) || w.tooManyFailures()) {
+				return
+			}
+			w.checkStale()
+			if burst--; burst > 0 {
+				timer.Reset(w.BurstGap)
+				continue
+			}
+			delay := w.refocusDelay()
+			if delay > time.Duration(float64(w.interval)*(1+w.Jitter)) {
+				w.log.Debug("Refocus failing, backing off", "delay", delay.String())
+			}
+			timer.Reset(delay)
+		}
+	}
+}
+
+// tooManyFailures applies FailurePolicy when exactly MaxFailures refocus
+// attempts in a row have failed, reporting whether the refocus loop should
+// stop because Run is returning.
+func (w *Watcher) tooManyFailures() bool {
+	w.mu.Lock()
+	failures := w.failures
+	w.mu.Unlock()
+	if w.MaxFailures <= 0 || failures != w.MaxFailures {
+		return false
+	}
+
+	if w.FailurePolicy == FailureAlert {
+		w.log.Error("Refocus failed too many times in a row, alerting", "failures", failures)
+		w.runHook("alert", w.AlertCommand)
+		return false
+	}
+	w.log.Error("Refocus failed too many times in a row, exiting", "failures", failures)
+	select {
+	case w.fatal <- fmt.Errorf("%w: %d", ErrTooManyFailures, failures):
+	default:
+	}
+	return true
+}
+
+// checkStale warns once StaleAfter has passed without a successful refocus
+// since the camera started being used, and again only after a success.
+func (w *Watcher) checkStale() {
+	if w.StaleAfter <= 0 {
+		return
+	}
+	w.mu.Lock()
+	since := w.lastSuccess
+	if since.Before(w.inUseSince) {
+		since = w.inUseSince
+	}
+	stale := w.inUse && time.Since(since) > w.StaleAfter
+	warn := stale && !w.staleWarned
+	w.staleWarned = stale
+	lastSuccess := w.lastSuccess
+	w.mu.Unlock()
+
+	if warn {
+		attrs := []any{"device", w.Device, "stale_after", w.StaleAfter.String()}
+		if !lastSuccess.IsZero() {
+			attrs = append(attrs, "last_success", lastSuccess.Format(time.RFC3339))
+		}
+		w.log.Warn("No successful refocus for too long, the camera may not be responding", attrs...)
+	}
+}
+
+// exitOnError makes Run return after the failed refocus with OnErrorExit,
+// reporting whether the refocus loop should stop.
+func (w *Watcher) exitOnError(err error) bool {
+	if w.OnError != OnErrorExit {
+		return false
+	}
+	w.log.Error("Refocus failed, exiting")
+	select {
+	case w.fatal <- fmt.Errorf("%w: %w", ErrRefocusFailed, err):
+	default:
+	}
+	return true
+}
+
+// refocusDelay returns how long to wait before the next refocus, backing off
+// exponentially from the refocus interval while refocusing fails with
+// OnErrorBackoff, randomized by Jitter.
+func (w *Watcher) refocusDelay() time.Duration {
+	w.mu.Lock()
+	failures := w.failures
+	w.mu.Unlock()
+	if w.OnError == OnErrorContinue {
+		failures = 0
+	}
+
+	max := w.MaxBackoff
+	if max <= 0 {
+		max = w.CheckInterval
+	}
+	delay := w.interval
+	for i := 0; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	if w.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + w.Jitter*(2*rand.Float64()-1)))
+	}
+	return delay
+}
+
+// Refocus refocuses the camera once, logging and returning any error. The
+// Controller is given CmdTimeout to finish. The timeout isn't tied to the
+// refocus loop's context so that an in-flight refocus can finish during
+// shutdown.
+func (w *Watcher) Refocus() error {
+	if err := w.runHook("pre", w.PreHook); err != nil && w.HookStrict {
+		w.log.Warn("Pre-refocus hook failed, skipping refocus")
+		return err
+	}
+	defer w.runHook("post", w.PostHook)
+
+	if w.DryRun {
+		w.log.Info("Dry run, would refocus", "controller", fmt.Sprint(w.Controller))
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.CmdTimeout)
+	defer cancel()
+
+	w.log.Debug("Refocusing", "device", w.Device, "controller", fmt.Sprint(w.Controller))
+	start := time.Now()
+	err := w.Controller.Refocus(ctx)
+	w.recordRefocus(err)
+	if err == nil && w.Callbacks.OnRefocus != nil {
+		w.callback(w.Callbacks.OnRefocus)
+	} else if err != nil && w.Callbacks.OnError != nil {
+		onError := w.Callbacks.OnError
+		w.callback(func() { onError(err) })
+	}
+	if w.Metrics != nil {
+		w.Metrics.observeRefocus(w.Name, time.Since(start), err)
+	}
+	if err == nil {
+		return nil
+	}
+
+	// Log command failures with their output and exit status as separate
+	// fields so they can be picked out by log collectors
+	attrs := []any{"duration", time.Since(start).String()}
+	if lastSuccess := w.Status().LastSuccess; !lastSuccess.IsZero() {
+		attrs = append(attrs, "since_last_success", time.Since(lastSuccess).Round(time.Second).String())
+	}
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		attrs = append(attrs, "command", strings.Join(cmdErr.Command, " "), "exit_status", cmdErr.ExitCode(), "output", cmdErr.Output, "err", cmdErr.Err)
+	} else {
+		attrs = append(attrs, "err", err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		w.log.Error("Refocus killed after exceeding timeout", append(attrs, "timeout", w.CmdTimeout.String())...)
+	} else {
+		w.log.Error("Error refocusing", attrs...)
+	}
+	return err
+}
+
+// Matched describes what the detection modes matched the last time InUse
+// reported the camera in use, ex: "proc: zoom".
+func (w *Watcher) Matched() string {
+	return w.matched
+}
+
+// setMatched records what a detection mode matched, reported in the log when
+// the camera starts being used.
+func (w *Watcher) setMatched(mode, what string) {
+	if w.matched != "" {
+		w.matched += "; "
+	}
+	w.matched += mode + ": " + what
+}
+
+// waitTimeout waits for wg to finish, giving up after timeout. It reports
+// whether wg finished in time.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
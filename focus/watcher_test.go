@@ -0,0 +1,661 @@
+package focus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/go-ps"
+)
+
+// discardLogger is the Logger of watchers under test.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// fakeProcess is a process in a fakeLister's list.
+type fakeProcess struct {
+	pid        int
+	executable string
+}
+
+func (p fakeProcess) Pid() int           { return p.pid }
+func (p fakeProcess) PPid() int          { return 1 }
+func (p fakeProcess) Executable() string { return p.executable }
+
+// fakeLister is a ProcessLister listing the processes last set. Its first
+// failures reads fail. It is safe for concurrent use.
+type fakeLister struct {
+	mu       sync.Mutex
+	procs    []ps.Process
+	failures int
+	reads    int
+}
+
+func (l *fakeLister) Processes() ([]ps.Process, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reads++
+	if l.reads <= l.failures {
+		return nil, errors.New("process exited while listing")
+	}
+	return l.procs, nil
+}
+
+// set makes the running processes executables, all with this test's pid so
+// the refocus loop finds the matched process still running.
+func (l *fakeLister) set(executables ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.procs = nil
+	for _, executable := range executables {
+		l.procs = append(l.procs, fakeProcess{pid: os.Getpid(), executable: executable})
+	}
+}
+
+// startWatcher runs w until the test ends, failing the test if Run returns an
+// error.
+func startWatcher(t *testing.T, w *Watcher) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run() = %v", err)
+		}
+	})
+}
+
+// waitFor waits up to a few seconds for cond to hold, failing the test with
+// what otherwise.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRefocusLoopRunsCommand(t *testing.T) {
+	runner := &fakeRunner{}
+	w, err := NewWatcher(Options{
+		Always:          true,
+		Command:         []string{"refocus", "/dev/video0"},
+		Runner:          runner,
+		CheckInterval:   time.Hour,
+		RefocusInterval: 5 * time.Millisecond,
+		Logger:          discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startWatcher(t, w)
+
+	waitFor(t, "3 refocuses", func() bool { return len(runner.Calls()) >= 3 })
+	for _, call := range runner.Calls() {
+		if !slices.Equal(call, w.Command) {
+			t.Errorf("ran %q, want %q", call, w.Command)
+		}
+	}
+	if status := w.Status(); !status.Monitoring || status.LastSuccess.IsZero() || status.ConsecutiveFailures != 0 {
+		t.Errorf("Status() = %+v, want monitoring with a success and no failures", status)
+	}
+}
+
+func TestRefocusLoopFollowsProcess(t *testing.T) {
+	runner := &fakeRunner{}
+	lister := &fakeLister{}
+	started := make(chan string, 10)
+	stopped := make(chan struct{}, 10)
+	w, err := NewWatcher(Options{
+		Processes:       []string{"zoom"},
+		Lister:          lister,
+		Command:         []string{"refocus"},
+		Runner:          runner,
+		CheckInterval:   time.Hour,
+		RefocusInterval: 5 * time.Millisecond,
+		Logger:          discardLogger,
+		Callbacks: Callbacks{
+			OnStart: func(matched string) { trySend(started, matched) },
+			OnStop:  func() { trySend(stopped, struct{}{}) },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startWatcher(t, w)
+
+	waitFor(t, "the first check", func() bool { return checks(w) > 0 })
+	if n := len(runner.Calls()); n != 0 {
+		t.Fatalf("refocused %d times before the process started", n)
+	}
+
+	lister.set("bash", "zoom")
+	w.CheckNow()
+	if matched := <-started; matched != "proc: zoom" {
+		t.Errorf("OnStart(%q), want %q", matched, "proc: zoom")
+	}
+	waitFor(t, "a refocus", func() bool { return len(runner.Calls()) > 0 })
+
+	lister.set("bash")
+	w.CheckNow()
+	<-stopped
+	if w.Status().Monitoring {
+		t.Error("still monitoring after the process stopped")
+	}
+	refocused := len(runner.Calls())
+	time.Sleep(20 * time.Millisecond)
+	if n := len(runner.Calls()); n != refocused {
+		t.Errorf("refocused %d more times after the process stopped", n-refocused)
+	}
+	select {
+	case matched := <-started:
+		t.Errorf("OnStart(%q) again", matched)
+	default:
+	}
+}
+
+func TestRefocusLoopRecordsFailures(t *testing.T) {
+	runner := &fakeRunner{results: []fakeResult{{output: []byte("camera wedged"), err: errors.New("exit status 1")}}}
+	errs := make(chan error, 10)
+	w, err := NewWatcher(Options{
+		Always:          true,
+		Command:         []string{"refocus"},
+		Runner:          runner,
+		OnError:         OnErrorContinue,
+		CheckInterval:   time.Hour,
+		RefocusInterval: 5 * time.Millisecond,
+		Logger:          discardLogger,
+		Callbacks:       Callbacks{OnError: func(err error) { trySend(errs, err) }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startWatcher(t, w)
+
+	err = <-errs
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Output != "camera wedged" {
+		t.Errorf("OnError(%v), want a CommandError with the output", err)
+	}
+	waitFor(t, "3 failures", func() bool { return w.Status().ConsecutiveFailures >= 3 })
+	if status := w.Status(); status.LastError == "" || !status.LastSuccess.IsZero() {
+		t.Errorf("Status() = %+v, want an error and no success", status)
+	}
+}
+
+// trySend sends v on ch unless its buffer is full, so a callback never blocks
+// the watcher.
+func trySend[T any](ch chan<- T, v T) {
+	select {
+	case ch <- v:
+	default:
+	}
+}
+
+// checks returns how many checks w has made.
+func checks(w *Watcher) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.checks
+}
+
+func TestRefocusDelayBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		onError    string
+		maxBackoff time.Duration
+		failures   int
+		want       time.Duration
+	}{
+		{name: "no failures", failures: 0, want: 10 * time.Second},
+		{name: "one failure", failures: 1, want: 20 * time.Second},
+		{name: "two failures", failures: 2, want: 40 * time.Second},
+		{name: "capped at check interval", failures: 3, want: time.Minute},
+		{name: "many failures", failures: 100, want: time.Minute},
+		{name: "max backoff", maxBackoff: 30 * time.Second, failures: 2, want: 30 * time.Second},
+		{name: "max backoff not reached", maxBackoff: 30 * time.Second, failures: 1, want: 20 * time.Second},
+		{name: "continue", onError: OnErrorContinue, failures: 3, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Watcher{Options: Options{
+				OnError:         tt.onError,
+				MaxBackoff:      tt.maxBackoff,
+				CheckInterval:   time.Minute,
+				RefocusInterval: 10 * time.Second,
+			}}
+			w.interval = w.RefocusInterval
+			w.failures = tt.failures
+			if got := w.refocusDelay(); got != tt.want {
+				t.Errorf("refocusDelay() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefocusDelayJitter(t *testing.T) {
+	w := &Watcher{Options: Options{CheckInterval: time.Minute, RefocusInterval: 10 * time.Second, Jitter: 0.1}}
+	w.interval = w.RefocusInterval
+	w.failures = 1
+	for i := 0; i < 100; i++ {
+		if got := w.refocusDelay(); got < 18*time.Second || got > 22*time.Second {
+			t.Fatalf("refocusDelay() = %s, want 20s ±10%%", got)
+		}
+	}
+}
+
+func TestRefocusLoopBacksOff(t *testing.T) {
+	const interval = 2 * time.Millisecond
+	fail := fakeResult{err: errors.New("exit status 1")}
+	runner := &fakeRunner{results: []fakeResult{fail, fail, fail, fail, fail, {}}}
+	w, err := NewWatcher(Options{
+		Always:          true,
+		Command:         []string{"refocus"},
+		Runner:          runner,
+		CheckInterval:   time.Hour,
+		RefocusInterval: interval,
+		MaxBackoff:      time.Second,
+		Logger:          discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startWatcher(t, w)
+
+	waitFor(t, "8 refocuses", func() bool { return len(runner.Calls()) >= 8 })
+	times := runner.Times()
+	// The delay doubles with each failure in a row: the nth wait follows n
+	// failures, up to the success of the 6th refocus
+	for n := 1; n <= 5; n++ {
+		if gap, want := times[n].Sub(times[n-1]), interval<<n; gap < want {
+			t.Errorf("waited %s after %d failures, want at least %s", gap, n, want)
+		}
+	}
+	if after, failing := times[6].Sub(times[5]), times[5].Sub(times[4]); after >= failing {
+		t.Errorf("waited %s after a success, want less than the %s while failing", after, failing)
+	}
+	if status := w.Status(); status.ConsecutiveFailures != 0 {
+		t.Errorf("ConsecutiveFailures = %d after a success, want 0", status.ConsecutiveFailures)
+	}
+}
+
+func TestCooldown(t *testing.T) {
+	lister := &fakeLister{}
+	var starts, stops int
+	w, err := NewWatcher(Options{
+		Processes:       []string{"zoom"},
+		Lister:          lister,
+		Command:         []string{"refocus"},
+		Runner:          &fakeRunner{},
+		CheckInterval:   time.Hour,
+		RefocusInterval: 30 * time.Minute,
+		Cooldown:        time.Minute,
+		Logger:          discardLogger,
+		Callbacks: Callbacks{
+			OnStart: func(string) { starts++ },
+			OnStop:  func() { stops++ },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	defer w.stopRefocus()
+
+	// zoom briefly exits and starts again within the cooldown
+	for _, running := range []bool{true, false, true, false} {
+		if running {
+			lister.set("zoom")
+		} else {
+			lister.set()
+		}
+		w.check(ctx)
+		if !w.Status().Monitoring {
+			t.Fatalf("stopped monitoring during the cooldown, running %v", running)
+		}
+	}
+	if starts != 1 || stops != 0 {
+		t.Errorf("started %d and stopped %d times during the cooldown, want 1 and 0", starts, stops)
+	}
+
+	// Then stays gone past it
+	w.lastInUse = time.Now().Add(-2 * w.Cooldown)
+	w.check(ctx)
+	if w.Status().Monitoring {
+		t.Error("still monitoring after the cooldown")
+	}
+	if starts != 1 || stops != 1 {
+		t.Errorf("started %d and stopped %d times after the cooldown, want 1 and 1", starts, stops)
+	}
+}
+
+// panickingController panics on its first refocus, then succeeds.
+type panickingController struct {
+	refocuses atomic.Int32
+}
+
+func (c *panickingController) Refocus(ctx context.Context) error {
+	if c.refocuses.Add(1) == 1 {
+		panic("ioctl went wrong")
+	}
+	return nil
+}
+
+func TestRefocusLoopRestartsAfterPanic(t *testing.T) {
+	controller := &panickingController{}
+	w, err := NewWatcher(Options{
+		Always:          true,
+		Controller:      controller,
+		CheckInterval:   time.Hour,
+		RefocusInterval: 5 * time.Millisecond,
+		Logger:          discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startWatcher(t, w)
+
+	waitFor(t, "refocusing after the panic", func() bool { return controller.refocuses.Load() >= 3 })
+	status := w.Status()
+	if status.LastSuccess.IsZero() || status.ConsecutiveFailures != 0 {
+		t.Errorf("Status() = %+v, want refocusing successfully again", status)
+	}
+	if checks(w) < 2 {
+		t.Errorf("checked %d times, want the panic to wake Run to check again", checks(w))
+	}
+}
+
+func TestHandOver(t *testing.T) {
+	var stops, starts atomic.Int32
+	newWatcher := func(logger *slog.Logger) (*Watcher, *fakeRunner) {
+		runner := &fakeRunner{}
+		w, err := NewWatcher(Options{
+			Always:          true,
+			Command:         []string{"refocus"},
+			Runner:          runner,
+			CheckInterval:   time.Hour,
+			RefocusInterval: 2 * time.Millisecond,
+			Logger:          logger,
+			Callbacks: Callbacks{
+				OnStart: func(string) { starts.Add(1) },
+				OnStop:  func() { stops.Add(1) },
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w, runner
+	}
+
+	first, firstRunner := newWatcher(discardLogger)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- first.Run(ctx) }()
+	waitFor(t, "3 refocuses", func() bool { return len(firstRunner.Calls()) >= 3 })
+	var logs bytes.Buffer
+	next, nextRunner := newWatcher(slog.New(slog.NewTextHandler(&logs, nil)))
+	first.HandOver(next)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	before := first.Status()
+	first.mu.Lock()
+	started, attempts := first.started, first.attempts
+	first.mu.Unlock()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() { done <- next.Run(ctx) }()
+	waitFor(t, "a refocus after the hand over", func() bool { return len(nextRunner.Calls()) > 0 })
+	if status := next.Status(); !status.Monitoring || status.LastSuccess.Before(before.LastSuccess) {
+		t.Errorf("Status() = %+v after the hand over, want monitoring and carrying on from %+v", status, before)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Callbacks still queued are delivered after Run returns
+	waitFor(t, "the stop callback", func() bool { return stops.Load() > 0 })
+	if n := starts.Load(); n != 1 {
+		t.Errorf("OnStart called %d times, want once as the camera stayed in use", n)
+	}
+	if n := stops.Load(); n != 1 {
+		t.Errorf("OnStop called %d times, want once when the last watcher stopped", n)
+	}
+	next.mu.Lock()
+	defer next.mu.Unlock()
+	if !next.started.Equal(started) {
+		t.Errorf("started %s after the hand over, want %s", next.started, started)
+	}
+	if next.attempts <= attempts {
+		t.Errorf("%d refocus attempts after the hand over, want more than the %d before", next.attempts, attempts)
+	}
+	if want := "refocus_attempts=" + strconv.Itoa(next.attempts); !strings.Contains(logs.String(), want) {
+		t.Errorf("logs = %q, want the summary to include %s", logs.String(), want)
+	}
+}
+
+// slowLister is a fakeLister that, once slow is set, blocks listing processes
+// until release is closed, like a hung /proc read.
+type slowLister struct {
+	fakeLister
+	slow    atomic.Bool
+	release chan struct{}
+}
+
+func (l *slowLister) Processes() ([]ps.Process, error) {
+	if l.slow.Load() {
+		<-l.release
+	}
+	return l.fakeLister.Processes()
+}
+
+func TestDetectTimeoutCarriesOn(t *testing.T) {
+	runner := &fakeRunner{}
+	lister := &slowLister{release: make(chan struct{})}
+	lister.set("zoom")
+	var stops atomic.Int32
+	w, err := NewWatcher(Options{
+		Processes:       []string{"zoom"},
+		Lister:          lister,
+		Command:         []string{"refocus"},
+		Runner:          runner,
+		CheckInterval:   time.Hour,
+		RefocusInterval: 2 * time.Millisecond,
+		DetectTimeout:   20 * time.Millisecond,
+		Logger:          discardLogger,
+		Callbacks:       Callbacks{OnStop: func() { stops.Add(1) }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	defer w.stopRefocus()
+
+	w.check(ctx)
+	waitFor(t, "a refocus", func() bool { return len(runner.Calls()) > 0 })
+
+	// The process list hangs: the check times out without stopping the
+	// refocus loop
+	lister.slow.Store(true)
+	w.check(ctx)
+	refocused := len(runner.Calls())
+	waitFor(t, "refocusing after the timed out check", func() bool { return len(runner.Calls()) > refocused })
+	if !w.Status().Monitoring || stops.Load() != 0 {
+		t.Errorf("monitoring %v with %d stops after detection timed out, want carrying on", w.Status().Monitoring, stops.Load())
+	}
+
+	// While the hung detection runs, checks skip too
+	w.check(ctx)
+	if !w.Status().Monitoring {
+		t.Error("stopped monitoring while the previous detection is still running")
+	}
+
+	lister.slow.Store(false)
+	close(lister.release)
+	waitFor(t, "the hung detection to finish", func() bool { return !w.detecting.Load() })
+	lister.set()
+	w.check(ctx)
+	if w.Status().Monitoring || stops.Load() != 1 {
+		t.Errorf("monitoring %v with %d stops once the process is gone, want stopped once", w.Status().Monitoring, stops.Load())
+	}
+}
+
+// countingController is a Controller counting its refocuses and when each
+// was made.
+type countingController struct {
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func (c *countingController) Refocus(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.times = append(c.times, time.Now())
+	return nil
+}
+
+// String names the controller in logs, without reading its fields while it
+// refocuses.
+func (c *countingController) String() string { return "counting" }
+
+// refocuses returns when each refocus was made, in order.
+func (c *countingController) refocuses() []time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Time(nil), c.times...)
+}
+
+func TestOneRefocusLoop(t *testing.T) {
+	const interval = 10 * time.Millisecond
+	controller := &countingController{}
+	w, err := NewWatcher(Options{
+		Always:          true,
+		Controller:      controller,
+		CheckInterval:   time.Hour,
+		RefocusInterval: interval,
+		Logger:          discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	defer w.stopRefocus()
+
+	// Two checks in a row finding the camera in use
+	w.check(ctx)
+	w.check(ctx)
+	waitFor(t, "6 refocuses", func() bool { return len(controller.refocuses()) >= 6 })
+	w.stopRefocus()
+
+	// A single loop waits a whole interval between refocuses, a second one
+	// would refocus in between
+	times := controller.refocuses()
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < interval/2 {
+			t.Fatalf("refocus %d came %s after the previous one, want one loop refocusing every %s", i+1, gap, interval)
+		}
+	}
+}
+
+// blockingController is a Controller whose refocuses block until release is
+// closed, like a slow refocus command.
+type blockingController struct {
+	started  chan struct{}
+	release  chan struct{}
+	finished atomic.Bool
+}
+
+func (c *blockingController) Refocus(ctx context.Context) error {
+	trySend(c.started, struct{}{})
+	<-c.release
+	c.finished.Store(true)
+	return nil
+}
+
+func TestRunWaitsForRefocus(t *testing.T) {
+	controller := &blockingController{started: make(chan struct{}, 1), release: make(chan struct{})}
+	w, err := NewWatcher(Options{
+		Always:          true,
+		Controller:      controller,
+		CheckInterval:   time.Hour,
+		RefocusInterval: time.Millisecond,
+		Logger:          discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	<-controller.started
+	cancel()
+	select {
+	case err := <-done:
+		t.Fatalf("Run() = %v during a refocus, want it to wait for the refocus", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(controller.release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() = %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Run() didn't return once the refocus finished")
+	}
+	if !controller.finished.Load() {
+		t.Error("Run() returned before the refocus finished")
+	}
+}
+
+func TestFatalErrorStops(t *testing.T) {
+	runner := &fakeRunner{results: []fakeResult{{}, {err: errors.New("exit status 1")}, {}}}
+	stopped := make(chan struct{}, 1)
+	w, err := NewWatcher(Options{
+		Always:          true,
+		Command:         []string{"refocus"},
+		OnStart:         []string{"on-start"},
+		OnStop:          []string{"on-stop"},
+		Runner:          runner,
+		OnError:         OnErrorExit,
+		CheckInterval:   time.Hour,
+		RefocusInterval: time.Millisecond,
+		Logger:          discardLogger,
+		Callbacks:       Callbacks{OnStop: func() { trySend(stopped, struct{}{}) }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// on-start succeeds, then the refocus fails
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatal("Run() = nil after a refocus failed with OnErrorExit")
+	}
+	calls := runner.Calls()
+	if last := calls[len(calls)-1]; !slices.Equal(last, w.OnStop) {
+		t.Errorf("last ran %q, want the on-stop hook %q", last, w.OnStop)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(3 * time.Second):
+		t.Error("OnStop not called after the fatal error")
+	}
+}
@@ -2,4 +2,7 @@ module stay-focused
 
 go 1.21
 
-require github.com/mitchellh/go-ps v1.0.0
+require (
+	github.com/mitchellh/go-ps v1.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)